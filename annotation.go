@@ -0,0 +1,374 @@
+package main
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// directive is a `//twintest:name args` comment attached to a declaration.
+// The name may be empty, as in `//twintest: f(2, 3) => 5`.
+type directive struct {
+	Name string
+	Args string
+}
+
+// directives extracts the twintest directives from a doc comment.
+func directives(doc *ast.CommentGroup) []directive {
+	if doc == nil {
+		return nil
+	}
+	var dirs []directive
+	for _, c := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		text, ok := strings.CutPrefix(text, "twintest:")
+		if !ok {
+			continue
+		}
+		end := strings.IndexFunc(text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+		})
+		if end < 0 {
+			end = len(text)
+		}
+		dirs = append(dirs, directive{
+			Name: text[:end],
+			Args: strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text[end:]), "=")),
+		})
+	}
+	return dirs
+}
+
+// hasDirective reports whether doc carries the twintest directive name.
+func hasDirective(doc *ast.CommentGroup, name string) bool {
+	for _, d := range directives(doc) {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseKeyValues splits `name="empty input" want=ErrEmpty` into its pairs,
+// in order. Values may be Go-quoted strings or bare words.
+func parseKeyValues(args string) [][2]string {
+	var pairs [][2]string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		eq := strings.IndexByte(args, '=')
+		if eq <= 0 {
+			break
+		}
+		key := strings.TrimSpace(args[:eq])
+		args = strings.TrimSpace(args[eq+1:])
+
+		value := args
+		if quoted, err := strconv.QuotedPrefix(args); err == nil {
+			value, _ = strconv.Unquote(quoted)
+			args = args[len(quoted):]
+		} else if sp := strings.IndexFunc(args, unicode.IsSpace); sp >= 0 {
+			value, args = args[:sp], args[sp:]
+		} else {
+			args = ""
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs
+}
+
+// CaseHint is a test case declared next to the code with
+// `//twintest:case name="..." want=EXPR`; any other pairs are kept verbatim
+// as a hint for filling in the inputs.
+type CaseHint struct {
+	Name  string
+	Want  string
+	Extra string
+}
+
+// caseHints collects the case directives in a function's doc comment.
+func caseHints(doc *ast.CommentGroup) []CaseHint {
+	var hints []CaseHint
+	for _, dir := range directives(doc) {
+		if dir.Name != "case" {
+			continue
+		}
+		var hint CaseHint
+		var extra []string
+		for _, kv := range parseKeyValues(dir.Args) {
+			switch kv[0] {
+			case "name":
+				hint.Name = kv[1]
+			case "want":
+				hint.Want = kv[1]
+			default:
+				extra = append(extra, kv[0]+"="+kv[1])
+			}
+		}
+		if hint.Name == "" {
+			hint.Name = "case " + strconv.Itoa(len(hints)+1)
+		}
+		hint.Extra = strings.Join(extra, " ")
+		hints = append(hints, hint)
+	}
+	return hints
+}
+
+// InlineSpec is a concrete example declared as `//twintest: f(2, 3) => 5`,
+// with its inputs and expectations rendered as table row field values.
+type InlineSpec struct {
+	Text   string
+	Values string
+}
+
+// inlineSpecs parses the unnamed directives of a function's doc comment into
+// table rows for the function's own parameters and results. Specs whose
+// arity does not match the signature are ignored.
+func inlineSpecs(doc *ast.CommentGroup, params, results []Field) []InlineSpec {
+	if len(results) == 0 {
+		return nil
+	}
+	fields := argFields(params)
+	var specs []InlineSpec
+	for _, dir := range directives(doc) {
+		if dir.Name != "" {
+			continue
+		}
+		call, want, ok := strings.Cut(dir.Args, "=>")
+		open, close := strings.IndexByte(call, '('), strings.LastIndexByte(call, ')')
+		if !ok || open < 0 || close < open {
+			continue
+		}
+		args := splitTopLevel(call[open+1 : close])
+		wants := splitTopLevel(want)
+		if len(wants) != len(results) {
+			continue
+		}
+
+		var values []string
+		for i, field := range fields {
+			if params[i].Variadic {
+				if i <= len(args) {
+					values = append(values, field.Name+": "+field.Type+"{"+strings.Join(args[i:], ", ")+"}")
+					args = args[:i]
+				}
+				break
+			}
+			if i >= len(args) {
+				break
+			}
+			values = append(values, field.Name+": "+args[i])
+		}
+		if len(values) != len(fields) || len(args) > len(fields) {
+			continue
+		}
+		for i, w := range wants {
+			values = append(values, wantName(i, results)+": "+w)
+		}
+		specs = append(specs, InlineSpec{
+			Text:   strings.TrimSpace(dir.Args),
+			Values: strings.Join(values, ", "),
+		})
+	}
+	return specs
+}
+
+// argFields names the table fields holding a function's arguments. Unnamed
+// parameters become argN, names clashing with the row's own fields get an
+// Arg suffix, and a variadic parameter is held as a slice.
+func argFields(params []Field) []Field {
+	fields := make([]Field, len(params))
+	for i, p := range params {
+		name := p.Name
+		if name == "" || name == "_" {
+			name = "arg" + strconv.Itoa(i)
+		} else if name == "name" || strings.HasPrefix(name, "want") || name == "tt" {
+			name += "Arg"
+		}
+		typ := p.Type
+		if p.Variadic {
+			typ = "[]" + p.Elem()
+		}
+		fields[i] = Field{Name: name, Type: typ}
+	}
+	return fields
+}
+
+func wantName(i int, results []Field) string {
+	if name := results[i].Name; name != "" && name != "_" {
+		return "want" + upperFirst(name)
+	}
+	if len(results) == 1 {
+		return "want"
+	}
+	return "want" + strconv.Itoa(i)
+}
+
+// splitTopLevel splits s at commas that are not nested in brackets or quotes.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// ArgFields returns the table fields holding fn's arguments.
+func (fn FuncInfo) ArgFields() []Field {
+	return argFields(fn.Params)
+}
+
+// WantFields returns the table fields holding fn's expected results.
+func (fn FuncInfo) WantFields() []Field {
+	fields := make([]Field, len(fn.Results))
+	for i, r := range fn.Results {
+		fields[i] = Field{Name: wantName(i, fn.Results), Type: r.Type}
+	}
+	return fields
+}
+
+// prefills reports whether the leaf for b asserts the literal results it
+// returns. Snapshots, diffs, channels, functions and iterators have leaves
+// of their own.
+func (fn FuncInfo) prefills(b *Branch) bool {
+	return len(b.Returns) == len(fn.Results) && len(b.Returns) > 0 && !fn.Snapshot && fn.Compare == "" &&
+		!fn.ReturnsChan() && !fn.ReturnsFunc() && !fn.ReturnsIter()
+}
+
+// GotNames lists the variables a call to fn assigns its results to, named
+// after the results when they have names.
+func (fn FuncInfo) GotNames() []string {
+	names := make([]string, len(fn.Results))
+	for i, r := range fn.Results {
+		names[i] = "got"
+		if r.Name != "" && r.Name != "_" {
+			names[i] += upperFirst(r.Name)
+		} else if len(fn.Results) > 1 {
+			names[i] += strconv.Itoa(i)
+		}
+	}
+	return names
+}
+
+// Call renders a call to fn with its arguments taken from the table row tt.
+// Methods are called on the suite's sut.
+func (fn FuncInfo) Call() string {
+	args := make([]string, 0, len(fn.Params))
+	for i, field := range fn.ArgFields() {
+		arg := "tt." + field.Name
+		if fn.Params[i].Variadic {
+			arg += "..."
+		}
+		args = append(args, arg)
+	}
+	return fn.Callee() + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Callee renders what a generated call invokes: the function itself, or the
+// method on the suite's sut.
+func (fn FuncInfo) Callee() string {
+	if fn.Receiver == "" {
+		return fn.Name
+	}
+	return "suite." + fn.Sut + "." + fn.Name
+}
+
+// Variadic returns fn's variadic parameter, or nil.
+func (fn FuncInfo) Variadic() *Field {
+	if n := len(fn.Params); n > 0 && fn.Params[n-1].Variadic {
+		return &fn.Params[n-1]
+	}
+	return nil
+}
+
+// Discard renders the left-hand side dropping every result of a call to fn,
+// such as "_, _ = ", or nothing when fn returns nothing.
+func (fn FuncInfo) Discard() string {
+	if len(fn.Results) == 0 {
+		return ""
+	}
+	return strings.Repeat("_, ", len(fn.Results)-1) + "_ = "
+}
+
+// HotPath is a function declared performance-critical with
+// `//twintest:hot allocs=N`, which gets a benchmark and a test keeping its
+// allocations per call within N, zero when not given.
+type HotPath struct {
+	Allocs int
+}
+
+// hotPath reads the hot directive of a function's doc comment, if any.
+func hotPath(doc *ast.CommentGroup) *HotPath {
+	for _, dir := range directives(doc) {
+		if dir.Name != "hot" {
+			continue
+		}
+		hot := &HotPath{}
+		for _, kv := range parseKeyValues(dir.Args) {
+			if n, err := strconv.Atoi(kv[1]); kv[0] == "allocs" && err == nil && n >= 0 {
+				hot.Allocs = n
+			}
+		}
+		return hot
+	}
+	return nil
+}
+
+// ctorHint reads the `//twintest:ctor NewXFromConfig` directive on a struct,
+// naming the constructor its suite sets up with.
+func ctorHint(doc *ast.CommentGroup) string {
+	for _, d := range directives(doc) {
+		if d.Name == "ctor" {
+			return d.Args
+		}
+	}
+	return ""
+}
+
+// fileHint reads the `//twintest:file=custom_name_test.go` directive on a
+// struct, naming the file its suite is generated into.
+func fileHint(doc *ast.CommentGroup) string {
+	for _, d := range directives(doc) {
+		if d.Name == "file" {
+			return d.Args
+		}
+	}
+	return ""
+}
+
+// typeInstances collects the `//twintest:types int, string` directives on a
+// generic struct, each a list of type arguments to instantiate a suite with.
+func typeInstances(doc *ast.CommentGroup) []string {
+	var insts []string
+	for _, d := range directives(doc) {
+		if d.Name != "types" {
+			continue
+		}
+		args := strings.TrimSuffix(strings.TrimPrefix(d.Args, "["), "]")
+		if args = strings.TrimSpace(args); args != "" {
+			insts = append(insts, args)
+		}
+	}
+	return insts
+}
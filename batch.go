@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isBatch reports whether -src names a directory, or a tree ending in
+// "/...", rather than a single source file.
+func isBatch(src string) bool {
+	if strings.HasSuffix(src, "/...") {
+		return true
+	}
+	info, err := os.Stat(src)
+	return err == nil && info.IsDir()
+}
+
+// runBatch generates the tests for every source file src expands to, package
+// by package. The per-file messages of run give way to a line per package,
+// and to a progress bar when status is a terminal; JSON events are kept.
+//
+// A SIGINT stops it once the file at hand is done, leaving a manifest of the
+// files done and to go; with -resume, a later run skips the files done.
+func runBatch(src string) error {
+	files, err := sourceFiles([]string{src})
+	if err != nil {
+		return err
+	}
+	var completed []string
+	if *resume {
+		m, err := readManifest(src)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			logEvent(os.Stderr, eventWarning, "warning: no interrupted run of "+src+" to resume, generating all files", "source", src)
+		} else {
+			completed = m.Completed
+			files = without(files, completed)
+		}
+	}
+	var dirs []string
+	byDir := make(map[string][]string)
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if byDir[dir] == nil {
+			dirs = append(dirs, dir)
+		}
+		byDir[dir] = append(byDir[dir], file)
+	}
+
+	failed := &batchError{files: len(files)}
+	p := newProgress(status, len(files), len(dirs))
+	if *logFormat != "json" {
+		status = io.Discard
+		defer func() { status = p.out }()
+	}
+
+	interrupted, stop := watchInterrupt()
+	defer stop()
+	done := make(map[string]bool)
+	for _, dir := range dirs {
+		if interrupted() {
+			break
+		}
+		start := time.Now()
+		generated := 0
+		for _, file := range byDir[dir] {
+			if interrupted() {
+				break
+			}
+			done[file] = true
+			p.update(file)
+			out, err := run(file, 0)
+			p.files++
+			if err != nil {
+				// one broken file should not cost the tests of all the others
+				failed.failures = append(failed.failures, batchFailure{file, err})
+				if *logFormat == "json" {
+					logFailure(file, err)
+				}
+				continue
+			}
+			completed = append(completed, file)
+			generated += len(out)
+		}
+		p.pkgs++
+		p.report(dir, len(byDir[dir]), generated, time.Since(start))
+	}
+	p.clear()
+	if interrupted() {
+		m := &manifest{Source: src, Completed: completed, Pending: without(files, sortedKeys(done))}
+		for _, f := range failed.failures {
+			m.Failed = append(m.Failed, f.file)
+		}
+		if err := writeManifest(src, m); err != nil {
+			return err
+		}
+		return &interruptError{manifest: manifestPath(src), completed: len(completed), pending: len(m.Failed) + len(m.Pending)}
+	}
+	if err := removeManifest(src); err != nil {
+		return err
+	}
+	logEvent(p.out, eventPackage, fmt.Sprintf("%d files in %d packages (%s)", p.files, p.pkgs, p.elapsed()),
+		"files", p.files, "packages", p.pkgs, "failed", len(failed.failures))
+	if len(failed.failures) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// without returns files less those in drop, in order.
+func without(files, drop []string) []string {
+	skip := make(map[string]bool, len(drop))
+	for _, f := range drop {
+		skip[f] = true
+	}
+	var kept []string
+	for _, f := range files {
+		if !skip[f] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// Exit codes of twintest.
+const (
+	exitFailure = 1 // nothing was generated
+	exitPartial = 2 // a batch run generated some files but failed on others
+)
+
+// batchFailure is a source file a batch run could not generate tests for.
+type batchFailure struct {
+	file string
+	err  error
+}
+
+// message is the failure as file:line: text, or file: text when the error
+// has no position.
+func (f batchFailure) message() string {
+	if msg := f.err.Error(); strings.HasPrefix(msg, f.file+":") {
+		return msg
+	}
+	return f.file + ": " + f.err.Error()
+}
+
+// batchError is the aggregated report of the files a batch run failed on,
+// after going on with the rest.
+type batchError struct {
+	failures []batchFailure
+	files    int
+}
+
+func (e *batchError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d files failed:", len(e.failures), e.files)
+	for _, f := range e.failures {
+		b.WriteString("\n\t" + f.message())
+	}
+	return b.String()
+}
+
+// exitCode tells a run that failed outright from one that got partway.
+func (e *batchError) exitCode() int {
+	if len(e.failures) < e.files {
+		return exitPartial
+	}
+	return exitFailure
+}
+
+// progress tracks a batch run for the user.
+type progress struct {
+	out         io.Writer
+	tty         bool // out is a terminal, so a progress bar can be redrawn in place
+	totalFiles  int
+	totalPkgs   int
+	files, pkgs int // done so far
+	start       time.Time
+}
+
+func newProgress(out io.Writer, totalFiles, totalPkgs int) *progress {
+	p := &progress{out: out, totalFiles: totalFiles, totalPkgs: totalPkgs, start: time.Now()}
+	if f, ok := out.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 && *logFormat != "json" {
+			p.tty = true
+		}
+	}
+	return p
+}
+
+// progressWidth is the number of cells in the progress bar.
+const progressWidth = 30
+
+// update redraws the progress bar, if there is one, for the file at hand.
+func (p *progress) update(file string) {
+	if !p.tty {
+		return
+	}
+	done := 0
+	if p.totalFiles > 0 {
+		done = progressWidth * p.files / p.totalFiles
+	}
+	bar := strings.Repeat("=", done) + strings.Repeat(" ", progressWidth-done)
+	fmt.Fprintf(p.out, "\r\033[K[%s] %d/%d %s", bar, p.files, p.totalFiles, file)
+}
+
+// clear removes the progress bar, so a line can be printed in its place.
+func (p *progress) clear() {
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+// report prints the line for a finished package.
+func (p *progress) report(dir string, files, generated int, took time.Duration) {
+	p.clear()
+	logEvent(p.out, eventPackage, fmt.Sprintf("[%d/%d] %s: %d files, %d test files (%s, %s elapsed)",
+		p.pkgs, p.totalPkgs, dir, files, generated, took.Round(time.Millisecond), p.elapsed()),
+		"dir", dir, "files", files, "tests", generated, "took", took)
+}
+
+func (p *progress) elapsed() time.Duration {
+	return time.Since(p.start).Round(time.Millisecond)
+}
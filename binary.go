@@ -0,0 +1,228 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// CLIFlag is a command-line flag a main package declares through the flag
+// package, as flag.String("name", ...) or flag.StringVar(&v, "name", ...).
+type CLIFlag struct {
+	Name    string
+	Kind    string // the flag constructor less Var, e.g. "String", "Bool", "Duration"
+	Default string // default value as in the source, "" for flag.Func
+	Long    bool   // spelled --name, as the pflag flags of cobra commands are
+}
+
+// flagKinds are the flag package constructors, by whether they take the
+// variable to set first.
+var flagKinds = map[string]bool{
+	"Bool": false, "BoolVar": true, "BoolFunc": false,
+	"Int": false, "IntVar": true, "Int64": false, "Int64Var": true,
+	"Uint": false, "UintVar": true, "Uint64": false, "Uint64Var": true,
+	"Float64": false, "Float64Var": true,
+	"String": false, "StringVar": true,
+	"Duration": false, "DurationVar": true,
+	"Func": false, "TextVar": true,
+}
+
+// collectFlags lists, in order of declaration, the flags node, a declaration
+// or a function body, declares on the command line through the flag package,
+// wherever in it it does.
+func collectFlags(node ast.Node, imports map[string]string) []CLIFlag {
+	var flags []CLIFlag
+	seen := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || imports[x.Name] != "flag" {
+			return true
+		}
+		takesVar, ok := flagKinds[sel.Sel.Name]
+		at := 0
+		if takesVar {
+			at = 1
+		}
+		if !ok || len(call.Args) < at+2 {
+			return true
+		}
+		lit, ok := call.Args[at].(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil || name == "" || seen[name] {
+			return true
+		}
+		seen[name] = true
+		f := CLIFlag{Name: name, Kind: strings.TrimSuffix(sel.Sel.Name, "Var")}
+		if f.Kind != "Func" && f.Kind != "BoolFunc" {
+			f.Default = types.ExprString(call.Args[at+1])
+		}
+		flags = append(flags, f)
+		return true
+	})
+	return flags
+}
+
+// mainFlags lists, in order of declaration, the flags the binary of a main
+// package declares: in package-level declarations and init functions, and in
+// the functions of file that main reaches. A function main never refers to
+// registers its flags on no binary.
+func mainFlags(file *ast.File, main *ast.FuncDecl, imports map[string]string) []CLIFlag {
+	reached := make(map[*ast.FuncDecl]bool)
+	var reach func(fn *ast.FuncDecl)
+	reach = func(fn *ast.FuncDecl) {
+		if reached[fn] || fn.Body == nil {
+			return
+		}
+		reached[fn] = true
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Obj != nil {
+				if decl, ok := id.Obj.Decl.(*ast.FuncDecl); ok {
+					reach(decl)
+				}
+			}
+			return true
+		})
+	}
+	reach(main)
+
+	var flags []CLIFlag
+	seen := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && !reached[fn] && (fn.Recv != nil || fn.Name.Name != "init") {
+			continue
+		}
+		for _, f := range collectFlags(decl, imports) {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				flags = append(flags, f)
+			}
+		}
+	}
+	return flags
+}
+
+// registersFlags reports whether body registers flags on flag.CommandLine,
+// through the flag package or the set itself, which panics the second
+// time a test runs it unless the test swaps in a fresh set.
+func registersFlags(body *ast.BlockStmt, imports map[string]string) bool {
+	if body == nil {
+		return false
+	}
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || found {
+			return !found
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x := sel.X
+		if set, ok := x.(*ast.SelectorExpr); ok && set.Sel.Name == "CommandLine" {
+			x = set.X // flag.CommandLine.String(...)
+		}
+		if id, ok := x.(*ast.Ident); ok && imports[id.Name] == "flag" {
+			_, isFlag := flagKinds[sel.Sel.Name]
+			found = isFlag || sel.Sel.Name == "Var"
+		}
+		return !found
+	})
+	return found
+}
+
+// MainBinary is the command a package main builds, which the test of its
+// main function builds and runs rather than calling main in process.
+type MainBinary struct {
+	Flags []CLIFlag
+}
+
+// FlagCase is one run of a command: its arguments, spelled as Go string
+// literals, and whether it is expected to fail.
+type FlagCase struct {
+	Name  string
+	Args  []string
+	Fails bool
+	TODO  bool // the arguments or the expectation are only a guess to check
+}
+
+// Arg returns the argument setting f to a value other than its default.
+// Strings and flag.Func values get a TODO placeholder, no value being known
+// to make sense.
+func (f CLIFlag) Arg() string {
+	name := "-" + f.Name
+	if f.Long {
+		name = "-" + name
+	}
+	other := func(value, alt string) string {
+		if f.Default == value {
+			return alt
+		}
+		return value
+	}
+	switch f.Kind {
+	case "Bool", "BoolFunc", "Count":
+		if f.Default == "true" {
+			return name + "=false"
+		}
+		return name
+	case "Int", "Int64", "Uint", "Uint64":
+		return name + "=" + other("1", "2")
+	case "Float64":
+		return name + "=" + other("1.5", "2.5")
+	case "Duration":
+		if f.Default == "time.Second" {
+			return name + "=1m"
+		}
+		return name + "=1s"
+	}
+	return name + "=TODO"
+}
+
+// Cases lists the runs the test makes of the binary: without arguments,
+// and when it declares flags, the runs of flagCases, to which the flag
+// package answers -h with exit code 0 and an unknown flag with 2.
+func (m *MainBinary) Cases() []FlagCase {
+	if len(m.Flags) == 0 {
+		return []FlagCase{{Name: "no arguments", TODO: true}}
+	}
+	return flagCases(m.Flags, false)
+}
+
+// flagCases lists one run of a command per combination of flags: without
+// arguments, asking for help, with an unknown flag, with each flag set on
+// its own, and with all of them. long spells them as pflag does.
+func flagCases(flags []CLIFlag, long bool) []FlagCase {
+	help, unknown := "-h", "-twintest-unknown-flag"
+	if long {
+		help, unknown = "--help", "--twintest-unknown-flag"
+	}
+	quote := func(arg string) []string { return []string{strconv.Quote(arg)} }
+	cases := []FlagCase{
+		{Name: "no arguments", TODO: true},
+		{Name: help, Args: quote(help)},
+		{Name: "unknown flag", Args: quote(unknown), Fails: true},
+	}
+	all := FlagCase{Name: "all flags", TODO: true}
+	for _, f := range flags {
+		arg := f.Arg()
+		cases = append(cases, FlagCase{Name: arg, Args: quote(arg), TODO: true})
+		all.Args = append(all.Args, strconv.Quote(arg))
+	}
+	if len(flags) > 1 {
+		cases = append(cases, all)
+	}
+	return cases
+}
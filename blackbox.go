@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// restrictBlackBox marks the structs the config lists as black-box, and
+// narrows every black-box suite to what the external _test package can
+// reach: exported methods and constructors, with nothing reset or rewired
+// inside the package. Unexported structs stay white-box.
+func restrictBlackBox(structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if si.Name == "" || si.IsInterface {
+			continue
+		}
+		si.BlackBox = si.BlackBox || slices.Contains(config.BlackBox, si.Name)
+		if !si.BlackBox {
+			continue
+		}
+		if !si.IsExported {
+			logEvent(os.Stderr, eventWarning, fmt.Sprintf("warning: %s is unexported, so it cannot be tested black-box", si.Name),
+				"struct", si.Name)
+			si.BlackBox = false
+			continue
+		}
+
+		methods := si.Methods[:0]
+		for _, fn := range si.Methods {
+			if fn.IsExported {
+				fn.Globals = nil
+				methods = append(methods, fn)
+			}
+		}
+		si.Methods = methods
+
+		fields := si.Fields[:0]
+		for _, f := range si.Fields {
+			if ast.IsExported(f.Key()) {
+				fields = append(fields, f)
+			}
+		}
+		si.Fields = fields
+
+		ctors := si.Constructors[:0]
+		for _, fn := range si.Constructors {
+			if fn.IsExported {
+				ctors = append(ctors, fn)
+			}
+		}
+		si.Constructors = ctors
+
+		for i := range si.FSFields {
+			si.FSFields[i].Inject = si.FSFields[i].Inject && ast.IsExported(si.FSFields[i].Name)
+		}
+
+		if si.IO != nil {
+			if !ast.IsExported(si.IO.Source) {
+				si.IO.Source = ""
+			}
+			if !ast.IsExported(si.IO.Sink) {
+				si.IO.Sink = ""
+			}
+		}
+	}
+}
+
+// qualifyBlackBox rewrites a generated file for the external _test package
+// of the package pkgName in dir: identifiers declared by the package get
+// qualified by it, and its import is added when any is. Code that does not
+// parse is returned as is, for format.Source to report.
+func qualifyBlackBox(code []byte, dir, pkgName string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return code, nil
+	}
+	exports, err := packageExports(dir, pkgName)
+	if err != nil {
+		return nil, err
+	}
+
+	// identifiers standing for something other than a package-level name
+	skip := make(map[*ast.Ident]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			skip[n.Sel] = true
+		case *ast.FuncDecl:
+			skip[n.Name] = true
+		case *ast.Field:
+			for _, name := range n.Names {
+				skip[name] = true
+			}
+		case *ast.CompositeLit:
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := kv.Key.(*ast.Ident); ok {
+						skip[id] = true
+					}
+				}
+			}
+		case *ast.BranchStmt:
+			if n.Label != nil {
+				skip[n.Label] = true
+			}
+		case *ast.LabeledStmt:
+			skip[n.Label] = true
+		}
+		return true
+	})
+
+	var offsets []int
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Obj == nil && !skip[id] && exports[id.Name] {
+			offsets = append(offsets, fset.Position(id.Pos()).Offset)
+		}
+		return true
+	})
+	if len(offsets) == 0 {
+		return code, nil
+	}
+	importPath, err := packagePath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(offsets)
+	var out bytes.Buffer
+	last := 0
+	for _, off := range offsets {
+		out.Write(code[last:off])
+		out.WriteString(pkgName + ".")
+		last = off
+	}
+	out.Write(code[last:])
+
+	spec := strconv.Quote(importPath)
+	if pkgName != path.Base(importPath) {
+		spec = pkgName + " " + spec
+	}
+	qualified := out.Bytes()
+	if i := bytes.Index(qualified, []byte("import (\n")); i >= 0 {
+		at := i + len("import (\n")
+		return slices.Concat(qualified[:at], []byte("\t"+spec+"\n"), qualified[at:]), nil
+	}
+	return qualified, nil
+}
+
+// packageExports collects the exported package-level names declared by the
+// non-test files of the package pkgName in dir.
+func packageExports(dir, pkgName string) (map[string]bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	exports := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil && d.Name.IsExported() {
+					exports[d.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						exports[s.Name.Name] = s.Name.IsExported()
+					case *ast.ValueSpec:
+						for _, id := range s.Names {
+							exports[id.Name] = id.IsExported()
+						}
+					}
+				}
+			}
+		}
+	}
+	return exports, nil
+}
+
+// packagePath works out the import path of the package in dir from the
+// module declared by the nearest go.mod above it, which is that of a nested
+// module and of the target of a replace alike; a vendored package keeps the
+// path it has under vendor/.
+func packagePath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root, module, _, err := readGoMod(dir)
+	if err != nil {
+		return "", err
+	}
+	if root == "" {
+		return "", fmt.Errorf("%s is in no module, so a black-box suite cannot import it", dir)
+	}
+	if module == "" {
+		return "", fmt.Errorf("%s: no module directive", filepath.Join(root, "go.mod"))
+	}
+	rel, _ := filepath.Rel(root, dir)
+	rel = filepath.ToSlash(rel)
+	// a vendored package is imported by the path under vendor/, not
+	// through the module vendoring it
+	if i := strings.LastIndex("/"+rel+"/", "/vendor/"); i >= 0 && len(rel) > i+len("vendor/") {
+		return rel[i+len("vendor/"):], nil
+	}
+	if rel == "." {
+		return module, nil
+	}
+	return module + "/" + rel, nil
+}
+
+// readGoMod reads the module path and Go version of the nearest go.mod at
+// or above dir, and the directory it is in; root is "" when there is none.
+func readGoMod(dir string) (root, module, goVersion string, err error) {
+	for root = dir; ; root = filepath.Dir(root) {
+		f, err := os.Open(filepath.Join(root, "go.mod"))
+		if err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				line := scanner.Text()
+				if i := strings.Index(line, "//"); i >= 0 {
+					line = line[:i]
+				}
+				line = strings.TrimSpace(line)
+				if rest, ok := strings.CutPrefix(line, "module "); ok {
+					module = strings.Trim(strings.TrimSpace(rest), "\"`")
+				} else if rest, ok := strings.CutPrefix(line, "go "); ok {
+					goVersion = strings.TrimSpace(rest)
+				}
+			}
+			return root, module, goVersion, scanner.Err()
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", "", "", err
+		}
+		if filepath.Dir(root) == root {
+			return "", "", "", nil
+		}
+	}
+}
+
+// moduleGoAtLeast reports whether the module of dir declares at least Go
+// 1.minor, so generated code may use what that release added.
+func moduleGoAtLeast(dir string, minor int) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	_, _, version, err := readGoMod(dir)
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 || parts[0] != "1" {
+		return false
+	}
+	digits := parts[1]
+	if i := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		digits = digits[:i] // as in 1.25rc1
+	}
+	n, err := strconv.Atoi(digits)
+	return err == nil && n >= minor
+}
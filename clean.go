@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generatedBy is how the first line of every generated file starts, with or
+// without the DO NOT EDIT marker.
+var generatedBy = []string{
+	"// Code generated by github.com/rogone/twintest",
+	"// Generated by github.com/rogone/twintest",
+}
+
+// runClean implements `twintest clean [-n] [path]`, which removes the files
+// twintest generated for a source file, a package directory, or a whole tree
+// when the path ends in "/...". Only _test.go files carrying the generated-by
+// line are touched, along with their -merge base copies.
+func runClean(args []string) error {
+	flags := flag.NewFlagSet("clean", flag.ExitOnError)
+	dryRun := flags.Bool("n", false, "print the files that would be removed without removing them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest clean [-n] [file.go | dir | dir/...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	path := "."
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(1)
+	} else if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	files, err := generatedFiles(path)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if *dryRun {
+			fmt.Printf("Would remove %s\n", file)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", file)
+		if err := os.Remove(basePath(file)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(filepath.Dir(basePath(file))) // only succeeds once empty
+	}
+	return nil
+}
+
+// generatedFiles lists the generated test files for path: those of one source
+// file, of one directory, or of a tree when path ends in "/...".
+func generatedFiles(path string) ([]string, error) {
+	if root, ok := strings.CutSuffix(path, "/..."); ok {
+		var files []string
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || d.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && isGenerated(p) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		return files, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	dir, prefix := path, ""
+	if err != nil || !info.IsDir() {
+		// a source file, which may already be gone
+		dir, prefix = filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ".go")+"_"
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if !e.IsDir() && (prefix == "" || fromSource(dir, prefix, e.Name())) && isGenerated(p) {
+			files = append(files, p)
+		}
+	}
+	return files, nil
+}
+
+// isGenerated reports whether path is a test file twintest generated: one
+// whose leading comments, after any -header banner, include the generated-by
+// line.
+func isGenerated(path string) bool {
+	if !strings.HasSuffix(path, "_test.go") {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+		for _, prefix := range generatedBy {
+			if strings.HasPrefix(line, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pruneOrphans looks for suites and contracts generated from src for types
+// it no longer declares, as left behind by renames and deletions, which stop
+// compiling. They are removed with -prune and reported otherwise.
+func pruneOrphans(src string, structInfo []*StructInfo) error {
+	declared := make(map[string]bool, len(structInfo))
+	for _, si := range structInfo {
+		declared[strings.ToLower(si.Name)] = true
+	}
+
+	files, err := generatedFiles(src)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(filepath.Base(src), ".go") + "_"
+	for _, file := range files {
+		typ, ok := testedType(strings.TrimPrefix(filepath.Base(file), prefix))
+		if !ok || declared[typ] {
+			continue
+		}
+		if !*prune || *output != "files" {
+			logEvent(os.Stderr, eventWarning, fmt.Sprintf("warning: %s tests %s, which %s no longer declares; -prune removes it", file, typ, src),
+				"file", file, "source", src)
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		os.Remove(basePath(file))
+		logEvent(status, eventPruned, "Pruned "+file, "file", file, "source", src)
+	}
+	return nil
+}
+
+// fromSource reports whether name is that of a file generated for the
+// source file prefix stands for, such as foo_ for foo.go: foo_branch_test.go
+// or foo_bar_suite_test.go, but not foo_bar_branch_test.go, which is
+// foo_bar.go's.
+func fromSource(dir, prefix, name string) bool {
+	rest, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return false
+	}
+	if rest == "branch_test.go" || rest == "init_test.go" {
+		return true
+	}
+	typ, ok := testedType(rest)
+	return ok && !ownedByOther(dir, prefix, typ)
+}
+
+// testedType returns the lower-cased type a suite or contract file tests,
+// given its name without the source prefix: bar for bar_suite_test.go,
+// bar_contract_test.go or the shard bar_suite_b_test.go.
+func testedType(name string) (string, bool) {
+	if typ, ok := strings.CutSuffix(name, "_suite_test.go"); ok {
+		return typ, true
+	}
+	if typ, ok := strings.CutSuffix(name, "_contract_test.go"); ok {
+		return typ, true
+	}
+	if m := shardPattern.FindStringSubmatch(name); m != nil {
+		return m[1], true
+	}
+	return "", false
+}
+
+// ownedByOther reports whether a sibling source file whose name extends
+// prefix, such as foo_bar.go for foo.go, may have generated the suite for
+// typ, e.g. foo_bar_baz_suite_test.go.
+func ownedByOther(dir, prefix, typ string) bool {
+	for i := strings.IndexByte(typ, '_'); i >= 0; {
+		if _, err := os.Stat(filepath.Join(dir, prefix+typ[:i]+".go")); err == nil {
+			return true
+		}
+		next := strings.IndexByte(typ[i+1:], '_')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
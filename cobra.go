@@ -0,0 +1,133 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// cobraPath is the import path of the cobra CLI library.
+const cobraPath = "github.com/spf13/cobra"
+
+// CobraCommand is the *cobra.Command a function builds, which its test
+// executes with arguments rather than calling the function alone.
+type CobraCommand struct {
+	Run   string    // the field running the command, "RunE" or "Run", "" if it sets none
+	Flags []CLIFlag // flags declared on cmd.Flags() or cmd.PersistentFlags()
+
+	body *ast.BlockStmt // body of the run function, when it is a literal
+}
+
+// Cases lists the executions of the command, one per combination of flags.
+func (c *CobraCommand) Cases() []FlagCase {
+	return flagCases(c.Flags, true)
+}
+
+// pflagKinds are the kinds of flag a pflag.FlagSet declares, with String
+// standing for String, StringP with a shorthand, StringVar into a variable
+// and StringVarP.
+var pflagKinds = map[string]bool{
+	"Bool": true, "Count": true, "Duration": true, "Float64": true,
+	"Int": true, "Int64": true, "IntSlice": true, "Uint": true, "Uint64": true,
+	"String": true, "StringArray": true, "StringSlice": true, "StringToString": true,
+}
+
+// isCobraCommand reports whether expr spells cobra.Command.
+func isCobraCommand(expr ast.Expr, imports map[string]string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Command" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && imports[x.Name] == cobraPath
+}
+
+// detectCobra returns the command fn builds when it returns a lone
+// *cobra.Command, or nil. The run function and the flags are those of the
+// cobra.Command literal and the flag declarations in its body.
+func detectCobra(fn *ast.FuncDecl, imports map[string]string) *CobraCommand {
+	if fn.Body == nil || fn.Type.Results == nil || fn.Type.Results.NumFields() != 1 {
+		return nil
+	}
+	star, ok := fn.Type.Results.List[0].Type.(*ast.StarExpr)
+	if !ok || !isCobraCommand(star.X, imports) {
+		return nil
+	}
+
+	cmd := &CobraCommand{}
+	seen := make(map[string]bool)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			if cmd.Run != "" || !isCobraCommand(n.Type, imports) {
+				break
+			}
+			for _, elt := range n.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				if key, ok := kv.Key.(*ast.Ident); ok && (key.Name == "RunE" || key.Name == "Run") {
+					cmd.Run = key.Name
+					if lit, ok := kv.Value.(*ast.FuncLit); ok {
+						cmd.body = lit.Body
+					}
+				}
+			}
+		case *ast.CallExpr:
+			if f, ok := pflagFlag(n); ok && !seen[f.Name] {
+				seen[f.Name] = true
+				cmd.Flags = append(cmd.Flags, f)
+			}
+		}
+		return true
+	})
+	return cmd
+}
+
+// pflagFlag returns the flag call declares, when it is one of the pflag
+// declarations on cmd.Flags() or cmd.PersistentFlags() with a literal name.
+func pflagFlag(call *ast.CallExpr) (CLIFlag, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return CLIFlag{}, false
+	}
+	set, ok := sel.X.(*ast.CallExpr)
+	if !ok {
+		return CLIFlag{}, false
+	}
+	if on, ok := set.Fun.(*ast.SelectorExpr); !ok || on.Sel.Name != "Flags" && on.Sel.Name != "PersistentFlags" {
+		return CLIFlag{}, false
+	}
+
+	method := sel.Sel.Name
+	base, short := strings.CutSuffix(method, "P")
+	if !short || !pflagKinds[strings.TrimSuffix(base, "Var")] {
+		base, short = method, false
+	}
+	kind, takesVar := strings.CutSuffix(base, "Var")
+	if !pflagKinds[kind] {
+		return CLIFlag{}, false
+	}
+	at := 0
+	if takesVar {
+		at = 1
+	}
+	def := at + 1
+	if short {
+		def++
+	}
+	if len(call.Args) <= def {
+		return CLIFlag{}, false
+	}
+	lit, ok := call.Args[at].(*ast.BasicLit)
+	if !ok {
+		return CLIFlag{}, false
+	}
+	name, err := strconv.Unquote(lit.Value)
+	if err != nil || name == "" {
+		return CLIFlag{}, false
+	}
+	return CLIFlag{Name: name, Kind: kind, Default: types.ExprString(call.Args[def]), Long: true}, true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"go/ast"
+	"path"
+	"strings"
+)
+
+// cmpOptions works out the cmp.Options a diff of values of typ needs, from
+// what the file shows of it: cmpopts.IgnoreUnexported for structs of the
+// file with unexported fields, cmpopts.EquateApproxTime where it holds a
+// time.Time, and protocmp.Transform for protobuf messages.
+func cmpOptions(typ string, structs map[string]*StructInfo, imports map[string]string) []string {
+	var unexported []string
+	approxTime, proto := false, false
+	seen := make(map[string]bool)
+
+	var visit func(typ string)
+	visit = func(typ string) {
+		name := elemTypeName(typ)
+		if qual, sel, ok := strings.Cut(name, "."); ok {
+			p := imports[qual]
+			switch {
+			case p == "time" && sel == "Time":
+				approxTime = true
+			case isProtoPackage(p):
+				proto = true
+			}
+			return
+		}
+		si := structs[name]
+		if si == nil || seen[name] {
+			return
+		}
+		seen[name] = true
+		hidden := false
+		for _, f := range si.Fields {
+			proto = proto || strings.HasSuffix(f.Type, "protoimpl.MessageState")
+			hidden = hidden || !ast.IsExported(f.Key())
+		}
+		if hidden && si.TypeParams == "" {
+			unexported = append(unexported, name+"{}")
+		}
+		for _, f := range si.Fields {
+			visit(f.Type)
+		}
+	}
+	visit(typ)
+
+	var opts []string
+	if proto {
+		// protocmp compares messages by their contents, unexported state and all
+		return []string{"protocmp.Transform()"}
+	}
+	if len(unexported) > 0 {
+		opts = append(opts, "cmpopts.IgnoreUnexported("+strings.Join(unexported, ", ")+")")
+	}
+	if approxTime {
+		opts = append(opts, "cmpopts.EquateApproxTime(time.Second)")
+	}
+	return opts
+}
+
+// elemTypeName strips pointers, slices, arrays, maps and type arguments from
+// typ down to the name of the type of its elements.
+func elemTypeName(typ string) string {
+	for {
+		switch {
+		case strings.HasPrefix(typ, "*"):
+			typ = typ[1:]
+		case strings.HasPrefix(typ, "[]"):
+			typ = typ[2:]
+		case strings.HasPrefix(typ, "map["):
+			// the values are what a diff mostly looks into
+			depth := 0
+			for i, r := range typ {
+				if r == '[' {
+					depth++
+				} else if r == ']' {
+					if depth--; depth == 0 {
+						typ = typ[i+1:]
+						break
+					}
+				}
+			}
+		case strings.HasPrefix(typ, "["):
+			typ = typ[strings.IndexByte(typ, ']')+1:]
+		default:
+			if i := strings.IndexByte(typ, '['); i >= 0 {
+				typ = typ[:i]
+			}
+			return strings.TrimSpace(typ)
+		}
+	}
+}
+
+// isProtoPackage guesses from its import path whether a package holds
+// generated protobuf messages, as those named like "userpb" or ".../proto".
+func isProtoPackage(importPath string) bool {
+	if importPath == "" {
+		return false
+	}
+	base := path.Base(importPath)
+	return strings.HasSuffix(base, "pb") || base == "proto" || strings.Contains(importPath, "/proto/")
+}
+
+// CmpArgs renders the options after the values in a call to cmp.Diff.
+func (fn FuncInfo) CmpArgs() string {
+	if len(fn.CmpOpts) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(fn.CmpOpts, ", ")
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is looked for in the source file's directory and its parents.
+const configFile = ".twintest.yaml"
+
+// Config is the contents of .twintest.yaml.
+type Config struct {
+	// PostProcess lists commands each generated file is piped through, in
+	// order, before it is written.
+	PostProcess []Plugin `yaml:"postprocess"`
+
+	// Constructors names, by struct, the constructor its suite sets up
+	// with, where a //twintest:ctor directive does not.
+	Constructors map[string]string `yaml:"constructors"`
+
+	// BlackBox lists the structs whose suites go in the external _test
+	// package, as a //twintest:blackbox directive does.
+	BlackBox []string `yaml:"blackbox"`
+
+	// Parallel decides which generated tests call t.Parallel.
+	Parallel ParallelConfig `yaml:"parallel"`
+
+	// Tags is the policy -struct-tags holds struct tags to.
+	Tags TagsConfig `yaml:"tags"`
+}
+
+// ParallelConfig is the parallel section of .twintest.yaml. Tests that set
+// environment variables, change directory or assign package variables stay
+// serial whatever it says.
+type ParallelConfig struct {
+	// Suites runs each suite in parallel with the other tests of the
+	// package. Its methods still run in order, as testify runs them on
+	// the one sut SetupTest builds.
+	Suites bool `yaml:"suites"`
+
+	// Methods runs the test of each package function in parallel.
+	Methods bool `yaml:"methods"`
+
+	// Serial lists the structs and functions that stay serial, such as
+	// suites sharing a fixture.
+	Serial []string `yaml:"serial"`
+}
+
+// Plugin is an external command that reads a generated file on stdin and
+// writes the transformed file to stdout. The file's path is passed in the
+// TWINTEST_FILE environment variable.
+type Plugin struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+}
+
+// config is the configuration in effect, loaded by main.
+var config Config
+
+// loadConfig reads the nearest .twintest.yaml at or above dir; having none is
+// the same as an empty one.
+func loadConfig(dir string) (Config, error) {
+	var cfg Config
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return cfg, err
+	}
+	for {
+		path := filepath.Join(dir, configFile)
+		text, err := os.ReadFile(path)
+		if err == nil {
+			if err := yaml.Unmarshal(text, &cfg); err != nil {
+				return cfg, fmt.Errorf("%s: %w", path, err)
+			}
+			for i, p := range cfg.PostProcess {
+				if len(p.Command) == 0 {
+					return cfg, fmt.Errorf("%s: postprocess[%d] has no command", path, i)
+				}
+			}
+			return cfg, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return cfg, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return cfg, nil
+		}
+		dir = parent
+	}
+}
+
+// postProcess pipes a generated file through the configured plugins.
+func postProcess(filename string, content []byte) ([]byte, error) {
+	for _, p := range config.PostProcess {
+		cmd := exec.Command(p.Command[0], p.Command[1:]...)
+		cmd.Env = append(os.Environ(), "TWINTEST_FILE="+filename)
+		cmd.Stdin = bytes.NewReader(content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			name := p.Name
+			if name == "" {
+				name = strings.Join(p.Command, " ")
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = fmt.Errorf("%w: %s", err, msg)
+			}
+			return nil, fmt.Errorf("postprocess %s: %w", name, err)
+		}
+		content = out
+	}
+	return content, nil
+}
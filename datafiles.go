@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// markDataFiles picks, with -data-files, the functions whose cases are kept
+// in files under testdata/: those taking arguments, whose arguments and
+// results all decode from JSON or YAML.
+func markDataFiles(structInfo []*StructInfo) {
+	if *dataFiles == "" {
+		return
+	}
+	structs := make(map[string]bool)
+	for _, si := range structInfo {
+		if si.Name != "" && !si.IsInterface {
+			structs[si.Name] = true
+		}
+	}
+	for _, si := range structInfo {
+		if si.IsInterface {
+			continue
+		}
+		for i := range si.Methods {
+			fn := &si.Methods[i]
+			if len(fn.Params) == 0 || fn.Generic {
+				continue
+			}
+			decodable := true
+			for _, p := range fn.Params {
+				decodable = decodable && isDataType(p.Elem(), structs)
+			}
+			for _, r := range fn.Results {
+				decodable = decodable && (isErrorType(r.Type) || isDataType(r.Type, structs))
+			}
+			fn.DataFiles = decodable
+		}
+	}
+}
+
+// dataBasics are the types JSON and YAML values decode into as is.
+var dataBasics = map[string]bool{
+	"string": true, "bool": true, "byte": true, "rune": true, "any": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "time.Time": true, "time.Duration": true,
+}
+
+// isDataType reports whether values of typ can be written in a data file:
+// basic types, structs of the file, and pointers, slices, arrays and
+// string-keyed maps of them.
+func isDataType(typ string, structs map[string]bool) bool {
+	switch {
+	case strings.HasPrefix(typ, "*"):
+		return isDataType(typ[1:], structs)
+	case strings.HasPrefix(typ, "[]"):
+		return isDataType(typ[2:], structs)
+	case strings.HasPrefix(typ, "map[string]"):
+		return isDataType(strings.TrimPrefix(typ, "map[string]"), structs)
+	case strings.HasPrefix(typ, "[") && strings.Contains(typ, "]"):
+		return isDataType(typ[strings.IndexByte(typ, ']')+1:], structs)
+	}
+	return dataBasics[typ] || structs[typ]
+}
+
+// DataDir is the directory under testdata/ holding fn's case files.
+func (fn FuncInfo) DataDir() string {
+	if fn.Receiver == "" {
+		return fn.Name
+	}
+	return fn.Receiver + "_" + fn.Name
+}
+
+// dataField is a field of the struct a data file decodes into.
+type dataField struct {
+	Key  string // the name in the file
+	Type string
+}
+
+// Name is the exported Go name of the field.
+func (f dataField) Name() string {
+	return upperFirst(f.Key)
+}
+
+// Tag is the struct tag naming the field in the file.
+func (f dataField) Tag() string {
+	return dataTag(f.Key)
+}
+
+// DataArgs are the fields of a data file's args.
+func (fn FuncInfo) DataArgs() []dataField {
+	var fields []dataField
+	for _, a := range fn.ArgFields() {
+		fields = append(fields, dataField{Key: a.Name, Type: a.Type})
+	}
+	return fields
+}
+
+// DataWants are the fields of a data file's want: the non-error results,
+// and whether an error is expected.
+func (fn FuncInfo) DataWants() []dataField {
+	var fields []dataField
+	for _, w := range fn.WantFields() {
+		if isErrorType(w.Type) {
+			fields = append(fields, dataField{Key: "wantErr", Type: "bool"})
+			continue
+		}
+		fields = append(fields, dataField{Key: w.Name, Type: w.Type})
+	}
+	return fields
+}
+
+// DataCall renders a call to fn with the arguments of the data file tt.
+func (fn FuncInfo) DataCall() string {
+	args := make([]string, len(fn.Params))
+	for i, field := range fn.ArgFields() {
+		args[i] = "tt.Args." + upperFirst(field.Name)
+		if fn.Params[i].Variadic {
+			args[i] += "..."
+		}
+	}
+	return fn.Callee() + "(" + strings.Join(args, ", ") + ")"
+}
+
+func dataTag(name string) string {
+	return "`" + *dataFiles + `:"` + name + `"` + "`"
+}
+
+// dataDecode is the function the loader decodes data files with.
+func dataDecode() string {
+	return *dataFiles + ".Unmarshal"
+}
+
+// HasDataFiles reports whether any method reads its cases from data files,
+// for the file to carry the loader.
+func (si *StructInfo) HasDataFiles() bool {
+	for _, fn := range si.Methods {
+		if fn.DataFiles {
+			return true
+		}
+	}
+	return false
+}
+
+// DataExt is the extension of the data files.
+func (fn FuncInfo) DataExt() string {
+	return "." + *dataFiles
+}
+
+// writeDataFiles seeds the testdata directory of every function with data
+// files that has none yet, with one case of zero values to copy from. Cases
+// already there belong to the user and are left alone.
+func writeDataFiles(dir string, si *StructInfo, report func(string, bool)) error {
+	for _, fn := range si.Methods {
+		if !fn.DataFiles {
+			continue
+		}
+		caseDir := filepath.Join(dir, "testdata", fn.DataDir())
+		if _, err := os.Stat(caseDir); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		args := make(map[string]any)
+		for _, field := range fn.ArgFields() {
+			args[field.Name] = dataZero(field.Type)
+		}
+		want := make(map[string]any)
+		for _, w := range fn.WantFields() {
+			if isErrorType(w.Type) {
+				want["wantErr"] = false
+				continue
+			}
+			want[w.Name] = dataZero(w.Type)
+		}
+		placeholder := map[string]any{"args": args, "want": want}
+
+		var content []byte
+		var err error
+		if *dataFiles == "yaml" {
+			content, err = yaml.Marshal(placeholder)
+		} else {
+			content, err = json.MarshalIndent(placeholder, "", "  ")
+			content = append(content, '\n')
+		}
+		if err != nil {
+			return err
+		}
+		file := filepath.Join(caseDir, "zero"+fn.DataExt())
+		if *output == "files" {
+			if err := os.MkdirAll(caseDir, 0755); err != nil {
+				return err
+			}
+		}
+		written, err := writeGenerated(file, content)
+		if err != nil {
+			return err
+		}
+		report(file, written)
+	}
+	return nil
+}
+
+// dataZero is the zero value of typ as written in a data file.
+func dataZero(typ string) any {
+	switch {
+	case typ == "string":
+		return ""
+	case typ == "bool":
+		return false
+	case typ == "time.Time":
+		return "0001-01-01T00:00:00Z"
+	case typ == "time.Duration" && *dataFiles == "yaml":
+		return "0s" // yaml.v3 decodes durations from strings only
+	case dataBasics[typ] && typ != "any":
+		return 0
+	case strings.HasPrefix(typ, "[]"):
+		return []any{}
+	case strings.HasPrefix(typ, "map["):
+		return map[string]any{}
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/constant"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// knownOS are the GOOS values a file name suffix or build constraint can pin.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"illumos": true, "ios": true, "js": true, "linux": true, "netbsd": true,
+	"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true,
+}
+
+// constValues are the constants conditions fold with: the package-level
+// constants of a file, by declaration so that a local shadowing one is not
+// taken for it, and qualified names such as runtime.GOOS.
+type constValues struct {
+	decls     map[*ast.Object]constant.Value
+	qualified map[string]constant.Value
+}
+
+// constEnv collects the package-level constants of a file whose values fold
+// from literals, and runtime.GOOS when the file is built for one OS only,
+// by its name or its //go:build line.
+func constEnv(node *ast.File, filename string, imports map[string]string) constValues {
+	env := constValues{decls: make(map[*ast.Object]constant.Value), qualified: make(map[string]constant.Value)}
+	for _, decl := range node.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if i < len(vs.Values) && name.Obj != nil {
+					if v, ok := evalConst(vs.Values[i], env); ok {
+						env.decls[name.Obj] = v
+					}
+				}
+			}
+		}
+	}
+
+	goos := ""
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(filename), ".go"), "_")
+	for _, part := range parts[1:] {
+		if knownOS[part] {
+			goos = part
+		}
+	}
+	for _, group := range node.Comments {
+		if group.Pos() > node.Package {
+			break
+		}
+		for _, c := range group.List {
+			if expr, err := constraint.Parse(c.Text); err == nil {
+				if tag, ok := expr.(*constraint.TagExpr); ok && knownOS[tag.Tag] {
+					goos = tag.Tag
+				}
+			}
+		}
+	}
+	for local, path := range imports {
+		if path == "runtime" && goos != "" {
+			env.qualified[local+".GOOS"] = constant.MakeString(goos)
+		}
+	}
+	return env
+}
+
+// evalConst folds expr to a constant using the values in env.
+func evalConst(expr ast.Expr, env constValues) (constant.Value, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		v := constant.MakeFromLiteral(e.Value, e.Kind, 0)
+		return v, v.Kind() != constant.Unknown
+	case *ast.Ident:
+		if e.Obj == nil {
+			switch e.Name {
+			case "true":
+				return constant.MakeBool(true), true
+			case "false":
+				return constant.MakeBool(false), true
+			}
+			return nil, false
+		}
+		v, ok := env.decls[e.Obj]
+		return v, ok
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok && x.Obj == nil {
+			v, ok := env.qualified[x.Name+"."+e.Sel.Name]
+			return v, ok
+		}
+	case *ast.ParenExpr:
+		return evalConst(e.X, env)
+	case *ast.UnaryExpr:
+		if x, ok := evalConst(e.X, env); ok {
+			if e.Op == token.NOT && x.Kind() != constant.Bool {
+				return nil, false
+			}
+			return safeConst(func() constant.Value { return constant.UnaryOp(e.Op, x, 0) })
+		}
+	case *ast.BinaryExpr:
+		x, okX := evalConst(e.X, env)
+		y, okY := evalConst(e.Y, env)
+		if !okX || !okY {
+			return nil, false
+		}
+		switch e.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return safeConst(func() constant.Value { return constant.MakeBool(constant.Compare(x, e.Op, y)) })
+		case token.SHL, token.SHR:
+			if s, ok := constant.Uint64Val(y); ok {
+				return safeConst(func() constant.Value { return constant.Shift(x, e.Op, uint(s)) })
+			}
+			return nil, false
+		}
+		return safeConst(func() constant.Value { return constant.BinaryOp(x, e.Op, y) })
+	}
+	return nil, false
+}
+
+// safeConst runs a go/constant operation, which panics on mismatched
+// operands, reporting failure instead.
+func safeConst(op func() constant.Value) (v constant.Value, ok bool) {
+	defer func() {
+		if recover() != nil {
+			v, ok = nil, false
+		}
+	}()
+	v = op()
+	return v, v.Kind() != constant.Unknown
+}
+
+// isConstBool reports whether expr folds to the boolean want.
+func isConstBool(expr ast.Expr, env constValues, want bool) bool {
+	v, ok := evalConst(expr, env)
+	return ok && v.Kind() == constant.Bool && constant.BoolVal(v) == want
+}
+
+// markDead marks the branches of a function body that constant conditions
+// make unreachable: an if whose condition folds to false, the else of one
+// that folds to true and the statements after it when its body does not
+// fall through, and the cases of a switch that cannot match.
+func markDead(body *ast.BlockStmt, branches []*Branch, env constValues, fset *token.FileSet) {
+	if body == nil {
+		return
+	}
+	type at struct{ typ, line int }
+	byPos := make(map[at]*Branch)
+	for _, b := range flattenBranches(branches) {
+		byPos[at{b.Type, b.Line}] = b
+	}
+	mark := func(typ int, pos token.Pos, reason string) {
+		if b := byPos[at{typ, fset.Position(pos).Line}]; b != nil && b.Dead == "" {
+			b.Dead = reason
+		}
+	}
+
+	// lines of the statements following an always-true if that never falls
+	// through, up to the end of its block
+	type lines struct{ after, to int }
+	var skipped []lines
+	skipRest := func(list []ast.Stmt, end token.Pos) {
+		for _, stmt := range list {
+			if s, ok := stmt.(*ast.IfStmt); ok && isConstBool(s.Cond, env, true) && terminates(s.Body) {
+				skipped = append(skipped, lines{fset.Position(s.End()).Line, fset.Position(end).Line})
+				return
+			}
+		}
+	}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.BlockStmt:
+			skipRest(s.List, s.End())
+		case *ast.CaseClause:
+			skipRest(s.Body, s.End())
+		case *ast.CommClause:
+			skipRest(s.Body, s.End())
+		case *ast.IfStmt:
+			typ := BranchIf
+			if b := byPos[at{BranchElseIf, fset.Position(s.Pos()).Line}]; b != nil {
+				typ = BranchElseIf
+			}
+			switch {
+			case isConstBool(s.Cond, env, false):
+				mark(typ, s.Pos(), "condition is always false")
+			case isConstBool(s.Cond, env, true) && s.Else != nil:
+				if _, ok := s.Else.(*ast.IfStmt); ok {
+					mark(BranchElseIf, s.Else.Pos(), "an earlier condition is always true")
+				} else {
+					mark(BranchElse, s.Else.Pos(), "the condition is always true")
+				}
+			}
+		case *ast.SwitchStmt:
+			markDeadCases(s, env, mark)
+		}
+		return true
+	})
+
+	// an else-if after an always-true condition takes the rest of its chain along
+	for _, b := range flattenBranches(branches) {
+		if b.Type != BranchIfHost {
+			continue
+		}
+		for i, child := range b.Children {
+			if child.Dead == "an earlier condition is always true" {
+				for _, rest := range b.Children[i+1:] {
+					if rest.Dead == "" {
+						rest.Dead = child.Dead
+					}
+				}
+				break
+			}
+		}
+	}
+
+	var skip func(branches []*Branch)
+	skip = func(branches []*Branch) {
+		for _, b := range branches {
+			for _, l := range skipped {
+				if b.Dead == "" && b.Line > l.after && b.Line <= l.to {
+					b.Dead = "an earlier if is always taken and does not fall through"
+				}
+			}
+			if b.Dead == "" {
+				skip(b.Children)
+			}
+		}
+	}
+	skip(branches)
+}
+
+// markDeadCases marks the cases of a switch on a constant tag that differ
+// from it, and the default if a case matches; or, without a tag, the cases
+// that are always false. A case the one before falls through to is live
+// whenever that one is.
+func markDeadCases(s *ast.SwitchStmt, env constValues, mark func(int, token.Pos, string)) {
+	var tag constant.Value
+	if s.Tag != nil {
+		v, ok := evalConst(s.Tag, env)
+		if !ok {
+			return
+		}
+		tag = v
+	}
+
+	matched, reached := false, false
+	var defaultPos token.Pos
+	for _, stmt := range s.Body.List {
+		cc := stmt.(*ast.CaseClause)
+		fallenInto := reached
+		reached = fallsThrough(cc)
+		if fallenInto {
+			continue
+		}
+		if cc.List == nil {
+			defaultPos = cc.Pos()
+			continue
+		}
+		if matched {
+			mark(BranchCase, cc.Pos(), "an earlier case always matches")
+			reached = false
+			continue
+		}
+		dead := true
+		for _, expr := range cc.List {
+			if tag == nil {
+				dead = dead && isConstBool(expr, env, false)
+				matched = matched || isConstBool(expr, env, true)
+				continue
+			}
+			v, ok := evalConst(expr, env)
+			if !ok {
+				dead = false
+				continue
+			}
+			eq, ok := safeConst(func() constant.Value { return constant.MakeBool(constant.Compare(tag, token.EQL, v)) })
+			if !ok {
+				dead = false
+			} else if constant.BoolVal(eq) {
+				dead = false
+				matched = true
+			}
+		}
+		if dead {
+			mark(BranchCase, cc.Pos(), "case can never match")
+			reached = false
+		}
+	}
+	if matched && defaultPos.IsValid() {
+		mark(BranchDefault, defaultPos, "a case always matches")
+	}
+}
+
+// fallsThrough reports whether a case clause ends in fallthrough, running
+// on into the next one.
+func fallsThrough(cc *ast.CaseClause) bool {
+	if len(cc.Body) == 0 {
+		return false
+	}
+	last, ok := cc.Body[len(cc.Body)-1].(*ast.BranchStmt)
+	return ok && last.Tok == token.FALLTHROUGH
+}
+
+// trimDead removes the branches marked unreachable, reporting each one.
+func trimDead(structInfo []*StructInfo, src string) {
+	var prune func(branches []*Branch) []*Branch
+	prune = func(branches []*Branch) []*Branch {
+		kept := branches[:0]
+		for _, b := range branches {
+			if b.Dead != "" {
+				logEvent(status, eventPruned, fmt.Sprintf("Pruned unreachable %s:%d %s (%s)", src, b.Line, b.CodeLine, b.Dead),
+					"source", src, "line", b.Line, "reason", b.Dead)
+				continue
+			}
+			b.Children = prune(b.Children)
+			if b.Type == BranchIfHost && len(b.Children) == 1 {
+				b = b.Children[0] // as parseIfStmt does for an if without else
+			}
+			kept = append(kept, b)
+		}
+		return kept
+	}
+	for _, si := range structInfo {
+		for i := range si.Methods {
+			si.Methods[i].Branches = prune(si.Methods[i].Branches)
+		}
+	}
+}
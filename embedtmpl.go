@@ -0,0 +1,258 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// templateExts are the extensions of files embedded as templates.
+var templateExts = map[string]bool{
+	".tmpl": true, ".tpl": true, ".gotmpl": true, ".gohtml": true, ".html": true,
+}
+
+// EmbeddedTemplate is a package-level variable a //go:embed directive fills
+// with templates.
+type EmbeddedTemplate struct {
+	Var      string
+	Patterns []string // the patterns of the directive, quoted as Go strings
+	FS       bool     // an embed.FS, parsed with ParseFS, rather than a string or []byte
+	Bytes    bool     // a []byte, converted to string to parse
+}
+
+// EmbeddedTemplates are the templates a file embeds, which the generated
+// test parses the way the file does, so syntax errors and undefined
+// functions fail a test rather than the program.
+type EmbeddedTemplates struct {
+	Pkg   string   // "text/template" or "html/template"
+	Funcs []string // package-level FuncMaps the file parses its templates with
+	Stubs []string // names of functions in FuncMap literals, stubbed for parsing, quoted
+	Files []EmbeddedTemplate
+	Data  string // the value the file executes its templates with, zero, as a Go expression; "" when unknown
+	Entry string // the template a set is executed through, quoted, when the file names only one
+}
+
+// Name is the name the template package goes by.
+func (e *EmbeddedTemplates) Name() string {
+	return path.Base(e.Pkg)
+}
+
+// embeddedTemplates returns the templates node embeds, or nil: variables
+// under //go:embed of template files, or parsed with Parse or ParseFS, in a
+// file importing text/template or html/template. When it imports both, the
+// test parses with the one whose New, Must or Parse functions it calls.
+func embeddedTemplates(node *ast.File, imports map[string]string) *EmbeddedTemplates {
+	e := &EmbeddedTemplates{}
+	for _, p := range imports {
+		switch {
+		case p == "text/template":
+			e.Pkg = p
+		case p == "html/template" && e.Pkg == "":
+			e.Pkg = p
+		}
+	}
+	if e.Pkg == "" {
+		return nil
+	}
+
+	parsed := make(map[string]bool)
+	funcs := make(map[string]bool)
+	dataTypes := make(map[string]bool)
+	entries := make(map[string]bool)
+	called := ""
+	ast.Inspect(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && called == "" {
+			p := imports[x.Name]
+			if (p == "text/template" || p == "html/template") &&
+				(sel.Sel.Name == "New" || sel.Sel.Name == "Must" || strings.HasPrefix(sel.Sel.Name, "Parse")) {
+				called = p
+			}
+		}
+		switch sel.Sel.Name {
+		case "Parse", "ParseFS":
+			arg := call.Args[0]
+			if conv, ok := arg.(*ast.CallExpr); ok && len(conv.Args) == 1 {
+				arg = conv.Args[0] // string(data)
+			}
+			if id, ok := arg.(*ast.Ident); ok {
+				parsed[id.Name] = true
+			}
+		case "Execute", "ExecuteTemplate":
+			if len(call.Args) < 2 {
+				break
+			}
+			dataTypes[executedType(call.Args[len(call.Args)-1])] = true
+			if sel.Sel.Name == "ExecuteTemplate" && len(call.Args) == 3 {
+				if lit, ok := call.Args[1].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					entries[lit.Value] = true
+				}
+			}
+		case "Funcs":
+			switch arg := call.Args[0].(type) {
+			case *ast.Ident:
+				// only package-level maps are in reach of the test
+				if (arg.Obj == nil || node.Scope.Lookup(arg.Name) != nil) && !funcs[arg.Name] {
+					funcs[arg.Name] = true
+					e.Funcs = append(e.Funcs, arg.Name)
+				}
+			case *ast.CompositeLit:
+				for _, elt := range arg.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok {
+						continue
+					}
+					if lit, ok := kv.Key.(*ast.BasicLit); ok && lit.Kind == token.STRING && !funcs[lit.Value] {
+						funcs[lit.Value] = true
+						e.Stubs = append(e.Stubs, lit.Value)
+					}
+				}
+			}
+		}
+		return true
+	})
+
+	for _, decl := range node.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			doc := valueSpec.Doc
+			if doc == nil && len(genDecl.Specs) == 1 {
+				doc = genDecl.Doc
+			}
+			patterns := embedPatterns(doc)
+			if len(patterns) == 0 || len(valueSpec.Names) != 1 {
+				continue
+			}
+			f := EmbeddedTemplate{Var: valueSpec.Names[0].Name}
+			switch typ := valueSpec.Type.(type) {
+			case *ast.Ident:
+				if typ.Name != "string" {
+					continue
+				}
+			case *ast.ArrayType:
+				if elt, ok := typ.Elt.(*ast.Ident); !ok || elt.Name != "byte" || typ.Len != nil {
+					continue
+				}
+				f.Bytes = true
+			case *ast.SelectorExpr:
+				if x, ok := typ.X.(*ast.Ident); !ok || imports[x.Name] != "embed" || typ.Sel.Name != "FS" {
+					continue
+				}
+				f.FS = true
+			default:
+				continue
+			}
+			isTemplate := parsed[f.Var]
+			for _, p := range patterns {
+				isTemplate = isTemplate || templateExts[path.Ext(p)]
+				f.Patterns = append(f.Patterns, strconv.Quote(p))
+			}
+			if isTemplate {
+				e.Files = append(e.Files, f)
+			}
+		}
+	}
+	if len(e.Files) == 0 {
+		return nil
+	}
+	if called != "" {
+		e.Pkg = called
+	}
+	if len(dataTypes) == 1 {
+		for typ := range dataTypes {
+			e.Data = zeroData(typ)
+		}
+	}
+	if len(entries) == 1 {
+		for name := range entries {
+			e.Entry = name
+		}
+	}
+	return e
+}
+
+// executedType returns the type of the data a template is executed with,
+// when the source spells it: a composite literal, or a variable or parameter
+// declared with a type or from such a literal. It is "" otherwise.
+func executedType(data ast.Expr) string {
+	switch d := data.(type) {
+	case *ast.CompositeLit:
+		if d.Type != nil {
+			return types.ExprString(d.Type)
+		}
+	case *ast.UnaryExpr:
+		if lit, ok := d.X.(*ast.CompositeLit); ok && d.Op == token.AND && lit.Type != nil {
+			return "*" + types.ExprString(lit.Type)
+		}
+	case *ast.Ident:
+		if d.Obj == nil {
+			return ""
+		}
+		switch decl := d.Obj.Decl.(type) {
+		case *ast.Field:
+			return types.ExprString(decl.Type)
+		case *ast.ValueSpec:
+			if decl.Type != nil {
+				return types.ExprString(decl.Type)
+			}
+			for i, name := range decl.Names {
+				if name.Name == d.Name && i < len(decl.Values) {
+					return executedType(decl.Values[i])
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range decl.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && id.Name == d.Name && len(decl.Lhs) == len(decl.Rhs) {
+					return executedType(decl.Rhs[i])
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// zeroData renders the zero value of a type templates are executed with,
+// with pointers to a new value so fields can be evaluated, or "" for types
+// that tell nothing of the fields the templates read.
+func zeroData(typ string) string {
+	switch {
+	case typ == "" || typ == "any" || typ == "interface{}":
+		return ""
+	case strings.HasPrefix(typ, "*"):
+		return "new(" + typ[1:] + ")"
+	}
+	return zeroValue(typ)
+}
+
+// embedPatterns returns the patterns of the //go:embed directives in doc.
+func embedPatterns(doc *ast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	var patterns []string
+	for _, c := range doc.List {
+		if rest, ok := strings.CutPrefix(c.Text, "//go:embed "); ok {
+			for _, p := range strings.Fields(rest) {
+				if unquoted, err := strconv.Unquote(p); err == nil {
+					p = unquoted
+				}
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go/scanner"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Events twintest reports its activity as, the "event" of each JSON line
+// with -log-format=json.
+const (
+	eventAnalyzed    = "analyzed"    // a source file was parsed
+	eventGenerated   = "generated"   // a test file was written
+	eventUnchanged   = "unchanged"   // a test file was already up to date
+	eventSkipped     = "skipped"     // a source file had nothing to generate
+	eventPruned      = "pruned"      // an orphaned test file or unreachable branch was dropped
+	eventPackage     = "package"     // a package of a batch run is done
+	eventDone        = "done"        // the run is over
+	eventInterrupted = "interrupted" // a batch run stopped on SIGINT, leaving a manifest
+	eventWarning     = "warning"     // something the user should look at
+	eventParseError  = "parse_error" // a source file does not parse
+	eventError       = "error"       // the run failed
+)
+
+// eventLevels raises the events that are not routine above info.
+var eventLevels = map[string]slog.Level{
+	eventWarning:     slog.LevelWarn,
+	eventInterrupted: slog.LevelWarn,
+	eventParseError:  slog.LevelError,
+	eventError:       slog.LevelError,
+}
+
+// logEvent reports activity to w: the text message as is, or with
+// -log-format=json a JSON line carrying the message, the event, and attrs,
+// alternating keys and values as for slog. Events with no text are only
+// worth reporting to machines.
+func logEvent(w io.Writer, event, text string, attrs ...any) {
+	if *logFormat != "json" {
+		if text != "" {
+			io.WriteString(w, text+"\n")
+		}
+		return
+	}
+	if text == "" {
+		text = event
+	}
+	logger := slog.New(slog.NewJSONHandler(w, nil))
+	logger.Log(context.Background(), eventLevels[event], text, append([]any{"event", event}, attrs...)...)
+}
+
+// logFailure reports the error that stopped the run for src, as a
+// parse_error event at the first position it gives when it is one.
+func logFailure(src string, err error) {
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		logEvent(os.Stderr, eventParseError, err.Error(), "source", src, "line", list[0].Pos.Line)
+		return
+	}
+	logEvent(os.Stderr, eventError, err.Error(), "source", src)
+}
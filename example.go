@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// ExampleOutput is what a function prints to standard output, inferred from
+// the fmt.Print, Printf and Println calls in its body for its Example.
+type ExampleOutput struct {
+	Lines    []string
+	Complete bool // every print is unconditional with literal arguments, and the example's call is the real one
+}
+
+// printers are the fmt functions writing to standard output, by how they
+// format their arguments. The builtin print and println write to standard
+// error, which examples do not see.
+var printers = map[string]func(args []any) string{
+	"Print":   func(args []any) string { return fmt.Sprint(args...) },
+	"Println": func(args []any) string { return fmt.Sprintln(args...) },
+	"Printf": func(args []any) string {
+		if format, ok := args[0].(string); ok {
+			return fmt.Sprintf(format, args[1:]...)
+		}
+		return fmt.Sprint(args...)
+	},
+}
+
+// inferOutput works out the output of body, or returns nil if it prints
+// nothing through fmt. Prints it cannot evaluate, or that depend on a
+// branch, leave the output incomplete.
+func inferOutput(body *ast.BlockStmt, imports map[string]string, params []Field) *ExampleOutput {
+	if body == nil {
+		return nil
+	}
+	topLevel := make(map[ast.Node]bool)
+	for _, stmt := range body.List {
+		if expr, ok := stmt.(*ast.ExprStmt); ok {
+			topLevel[expr.X] = true
+		}
+	}
+
+	var out *ExampleOutput
+	var text strings.Builder
+	ast.Inspect(body, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false // runs whenever its caller decides
+		}
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		printer := fmtPrinter(call, imports)
+		if printer == nil {
+			return true
+		}
+		if out == nil {
+			out = &ExampleOutput{Complete: len(params) == 0}
+		}
+		args, literal := literalArgs(call.Args)
+		if !literal {
+			out.Complete = false
+			return true
+		}
+		if !topLevel[call] {
+			out.Complete = false
+		}
+		text.WriteString(printer(args))
+		return true
+	})
+	if out != nil {
+		if s := strings.TrimRight(text.String(), "\n"); s != "" {
+			out.Lines = strings.Split(s, "\n")
+		}
+	}
+	return out
+}
+
+// fmtPrinter returns the formatting of a call to fmt.Print, Printf or
+// Println, or nil for any other call.
+func fmtPrinter(call *ast.CallExpr, imports map[string]string) func([]any) string {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || imports[x.Name] != "fmt" {
+		return nil
+	}
+	return printers[sel.Sel.Name]
+}
+
+// literalArgs evaluates call arguments that are all basic literals, true or
+// false, reporting whether they were.
+func literalArgs(exprs []ast.Expr) ([]any, bool) {
+	var args []any
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case *ast.BasicLit:
+			var v any
+			var err error
+			switch e.Kind {
+			case token.STRING:
+				v, err = strconv.Unquote(e.Value)
+			case token.INT:
+				v, err = strconv.ParseInt(strings.ReplaceAll(e.Value, "_", ""), 0, 64)
+				if err == nil {
+					v = int(v.(int64))
+				}
+			case token.FLOAT:
+				v, err = strconv.ParseFloat(strings.ReplaceAll(e.Value, "_", ""), 64)
+			case token.CHAR:
+				var s string
+				if s, err = strconv.Unquote(e.Value); err == nil {
+					v = []rune(s)[0]
+				}
+			default:
+				return nil, false
+			}
+			if err != nil {
+				return nil, false
+			}
+			args = append(args, v)
+		case *ast.Ident:
+			if e.Name != "true" && e.Name != "false" {
+				return nil, false
+			}
+			args = append(args, e.Name == "true")
+		default:
+			return nil, false
+		}
+	}
+	return args, true
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+)
+
+// fact is a comparison of a parameter with a constant known to hold at some
+// point of a function, such as n > 10 inside `if n > 10 {`.
+type fact struct {
+	param string
+	op    token.Token
+	value constant.Value
+}
+
+func (f fact) String() string {
+	return f.param + " " + f.op.String() + " " + f.value.ExactString()
+}
+
+// holds reports whether x satisfies f.
+func (f fact) holds(x constant.Value) bool {
+	v, ok := safeConst(func() constant.Value { return constant.MakeBool(constant.Compare(x, f.op, f.value)) })
+	return ok && constant.BoolVal(v)
+}
+
+// compatible reports whether some value of a parameter of kind satisfies
+// both a and b. Two comparisons bound the values to an interval, or a line
+// less a point, which is empty unless it holds one of the constants, one
+// past them or, for floats, one between them.
+func compatible(a, b fact, kind constant.Kind) bool {
+	candidates := []constant.Value{a.value, b.value}
+	switch kind {
+	case constant.Bool:
+		candidates = []constant.Value{constant.MakeBool(true), constant.MakeBool(false)}
+	case constant.String:
+		ordered := func(op token.Token) bool { return op != token.EQL && op != token.NEQ }
+		if ordered(a.op) || ordered(b.op) {
+			return true // not worth the trouble for strings
+		}
+		candidates = append(candidates, constant.MakeString(constant.StringVal(a.value)+constant.StringVal(b.value)+"x"))
+	default:
+		one := constant.MakeInt64(1)
+		for _, c := range []constant.Value{a.value, b.value} {
+			for _, op := range []token.Token{token.ADD, token.SUB} {
+				if v, ok := safeConst(func() constant.Value { return constant.BinaryOp(c, op, one) }); ok {
+					candidates = append(candidates, v)
+				}
+			}
+		}
+		if kind == constant.Float {
+			sum, ok := safeConst(func() constant.Value { return constant.BinaryOp(a.value, token.ADD, b.value) })
+			if ok {
+				if mid, ok := safeConst(func() constant.Value { return constant.BinaryOp(sum, token.QUO, constant.MakeInt64(2)) }); ok {
+					candidates = append(candidates, mid)
+				}
+			}
+		}
+	}
+	for _, x := range candidates {
+		if a.holds(x) && b.holds(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// paramKinds returns the kind of constant each parameter compares with, for
+// those of a predeclared basic type; the others are not reasoned about.
+func paramKinds(params []Field) map[string]constant.Kind {
+	kinds := make(map[string]constant.Kind)
+	for _, p := range params {
+		switch {
+		case p.Name == "" || p.Name == "_" || p.Variadic:
+		case isIntType(p.Type):
+			kinds[p.Name] = constant.Int
+		case p.Type == "float32" || p.Type == "float64":
+			kinds[p.Name] = constant.Float
+		case p.Type == "string":
+			kinds[p.Name] = constant.String
+		case p.Type == "bool":
+			kinds[p.Name] = constant.Bool
+		}
+	}
+	return kinds
+}
+
+// feasibility finds the branches of one function whose conditions contradict
+// those holding on the way to them.
+type feasibility struct {
+	kinds map[string]constant.Kind // parameters reasoned about
+	env   constValues
+	mark  func(typ int, pos token.Pos, reason string)
+}
+
+// markInfeasible marks, for -precise, the branches of a function body that
+// no input reaches because their condition contradicts one holding there:
+// an enclosing if, the earlier conditions of an if-else chain, or a guard
+// returning early before them, as in
+//
+//	if n < 0 {
+//		return ErrNegative
+//	}
+//	if n < -10 { // infeasible
+//
+// It only reasons about parameters of basic types the body never assigns,
+// compared with constants, so it misses many contradictions but reports no
+// reachable branch.
+func markInfeasible(body *ast.BlockStmt, branches []*Branch, params []Field, env constValues, fset *token.FileSet) {
+	if body == nil {
+		return
+	}
+	kinds := paramKinds(params)
+	for name := range assignedNames(body) {
+		delete(kinds, name)
+	}
+	if len(kinds) == 0 {
+		return
+	}
+
+	type at struct{ typ, line int }
+	byPos := make(map[at]*Branch)
+	for _, b := range flattenBranches(branches) {
+		byPos[at{b.Type, b.Line}] = b
+	}
+	f := &feasibility{kinds: kinds, env: env, mark: func(typ int, pos token.Pos, reason string) {
+		if b := byPos[at{typ, fset.Position(pos).Line}]; b != nil && b.Dead == "" {
+			b.Dead = reason
+		}
+	}}
+	f.block(body.List, nil)
+}
+
+// assignedNames collects the identifiers body assigns, declares, increments
+// or takes the address of, whose comparisons may not hold later on.
+func assignedNames(body *ast.BlockStmt) map[string]bool {
+	names := make(map[string]bool)
+	add := func(e ast.Expr) {
+		if id, ok := e.(*ast.Ident); ok {
+			names[id.Name] = true
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				add(lhs)
+			}
+		case *ast.IncDecStmt:
+			add(n.X)
+		case *ast.RangeStmt:
+			add(n.Key)
+			add(n.Value)
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				add(n.X)
+			}
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				names[name.Name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// atom returns the fact expr states, or !expr when negate is set, if it
+// compares a parameter reasoned about with a constant.
+func (f *feasibility) atom(expr ast.Expr, negate bool) (fact, bool) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return f.atom(e.X, negate)
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return f.atom(e.X, !negate)
+		}
+	case *ast.Ident:
+		if f.kinds[e.Name] == constant.Bool {
+			return fact{e.Name, token.EQL, constant.MakeBool(!negate)}, true
+		}
+	case *ast.BinaryExpr:
+		op, ok := negated[e.Op]
+		if !ok {
+			return fact{}, false
+		}
+		if !negate {
+			op = e.Op
+		}
+		param, value := e.X, e.Y
+		if id, ok := param.(*ast.Ident); !ok || f.kinds[id.Name] == constant.Unknown {
+			param, value, op = e.Y, e.X, mirrored[op]
+		}
+		id, ok := param.(*ast.Ident)
+		if !ok || f.kinds[id.Name] == constant.Unknown {
+			return fact{}, false
+		}
+		v, ok := evalConst(value, f.env)
+		if !ok || !sameKind(v.Kind(), f.kinds[id.Name]) {
+			return fact{}, false
+		}
+		return fact{id.Name, op, v}, true
+	}
+	return fact{}, false
+}
+
+// sameKind reports whether a constant of kind k compares with a parameter
+// of kind param.
+func sameKind(k, param constant.Kind) bool {
+	if param == constant.Float {
+		return k == constant.Int || k == constant.Float
+	}
+	return k == param
+}
+
+// holding returns the facts following from cond being true, or false when
+// negate is set: each comparison of a conjunction, or of a negated
+// disjunction.
+func (f *feasibility) holding(cond ast.Expr, negate bool) []fact {
+	if p, ok := cond.(*ast.ParenExpr); ok {
+		return f.holding(p.X, negate)
+	}
+	if u, ok := cond.(*ast.UnaryExpr); ok && u.Op == token.NOT {
+		if _, isBinary := ast.Unparen(u.X).(*ast.BinaryExpr); isBinary {
+			return f.holding(u.X, !negate)
+		}
+	}
+	if b, ok := cond.(*ast.BinaryExpr); ok && (b.Op == token.LAND && !negate || b.Op == token.LOR && negate) {
+		return append(f.holding(b.X, negate), f.holding(b.Y, negate)...)
+	}
+	if a, ok := f.atom(cond, negate); ok {
+		return []fact{a}
+	}
+	return nil
+}
+
+// contradiction describes how added contradicts known, or the facts added
+// one another, or is "" when they may all hold.
+func (f *feasibility) contradiction(known, added []fact) string {
+	all := append(known[:len(known):len(known)], added...)
+	for i, a := range added {
+		for _, b := range all[:len(known)+i] {
+			if a.param == b.param && !compatible(a, b, f.kinds[a.param]) {
+				return fmt.Sprintf("%s contradicts %s", a, b)
+			}
+		}
+	}
+	return ""
+}
+
+// block walks a statement list under the facts known at its start, adding
+// the negated condition of every if that leaves the block when taken.
+func (f *feasibility) block(list []ast.Stmt, known []fact) {
+	for _, stmt := range list {
+		f.stmt(stmt, known)
+		if s, ok := stmt.(*ast.IfStmt); ok && s.Else == nil && terminates(s.Body) {
+			known = append(known[:len(known):len(known)], f.holding(s.Cond, true)...)
+		}
+	}
+}
+
+func (f *feasibility) stmt(stmt ast.Stmt, known []fact) {
+	switch s := stmt.(type) {
+	case *ast.IfStmt:
+		f.ifStmt(s, BranchIf, known)
+	case *ast.BlockStmt:
+		f.block(s.List, known)
+	case *ast.LabeledStmt:
+		f.stmt(s.Stmt, known)
+	case *ast.ForStmt:
+		f.block(s.Body.List, known)
+	case *ast.RangeStmt:
+		f.block(s.Body.List, known)
+	case *ast.SwitchStmt:
+		f.switchStmt(s, known)
+	case *ast.TypeSwitchStmt:
+		for _, cc := range s.Body.List {
+			f.block(cc.(*ast.CaseClause).Body, known)
+		}
+	case *ast.SelectStmt:
+		for _, cc := range s.Body.List {
+			f.block(cc.(*ast.CommClause).Body, known)
+		}
+	}
+}
+
+// ifStmt walks an if and its else chain, marking the branches whose
+// condition contradicts what holds there. typ is BranchIf, or BranchElseIf
+// for an if in an else.
+func (f *feasibility) ifStmt(s *ast.IfStmt, typ int, known []fact) {
+	then := f.holding(s.Cond, false)
+	if reason := f.contradiction(known, then); reason != "" {
+		f.mark(typ, s.Pos(), "infeasible: "+reason)
+	} else {
+		f.block(s.Body.List, append(known[:len(known):len(known)], then...))
+	}
+
+	otherwise := append(known[:len(known):len(known)], f.holding(s.Cond, true)...)
+	switch e := s.Else.(type) {
+	case *ast.IfStmt:
+		f.ifStmt(e, BranchElseIf, otherwise)
+	case *ast.BlockStmt:
+		if reason := f.contradiction(known, otherwise[len(known):]); reason != "" {
+			f.mark(BranchElse, e.Pos(), "infeasible: "+reason)
+		} else {
+			f.block(e.List, otherwise)
+		}
+	}
+}
+
+// switchStmt walks the cases of a switch, marking those a tag parameter or
+// the conditions of a tagless switch cannot satisfy, given that the earlier
+// cases did not match. A case the one before falls through to is reached
+// whenever that one is, so it is walked under what held before both.
+func (f *feasibility) switchStmt(s *ast.SwitchStmt, known []fact) {
+	// cond is what a case expression of the switch states
+	cond := func(expr ast.Expr) ast.Expr { return expr }
+	if id, ok := s.Tag.(*ast.Ident); ok && f.kinds[id.Name] != constant.Unknown {
+		cond = func(expr ast.Expr) ast.Expr { return &ast.BinaryExpr{X: id, Op: token.EQL, Y: expr} }
+	} else if s.Tag != nil {
+		cond = nil
+	}
+	fallenInto, before := false, known // before is what held ahead of the case falling through
+	for _, stmt := range s.Body.List {
+		cc := stmt.(*ast.CaseClause)
+		var holds []fact
+		if cond != nil && len(cc.List) == 1 {
+			holds = f.holding(cond(cc.List[0]), false)
+		}
+		feasible := true
+		if fallenInto {
+			f.block(cc.Body, before)
+		} else if reason := f.contradiction(known, holds); reason != "" {
+			f.mark(BranchCase, cc.Pos(), "infeasible: "+reason)
+			feasible = false
+		} else {
+			f.block(cc.Body, append(known[:len(known):len(known)], holds...))
+		}
+		if !fallenInto {
+			before = known
+		}
+		fallenInto = feasible && fallsThrough(cc)
+		if cond != nil && cc.List != nil {
+			for _, expr := range cc.List {
+				known = append(known[:len(known):len(known)], f.holding(cond(expr), true)...)
+			}
+		}
+	}
+}
+
+// terminates reports whether a block always leaves the statement list it is
+// in: it ends in a return, a panic, a break or a continue.
+func terminates(body *ast.BlockStmt) bool {
+	if len(body.List) == 0 {
+		return false
+	}
+	switch s := body.List[len(body.List)-1].(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return s.Tok == token.BREAK || s.Tok == token.CONTINUE
+	case *ast.ExprStmt:
+		call, ok := s.X.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		return ok && id.Name == "panic"
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FSDep is a file system a struct holds in a field, or a function takes as a
+// parameter, which tests stand in for with a fstest.MapFS.
+type FSDep struct {
+	Name   string   // the field or parameter
+	Embed  bool     // an embed.FS, which only a change of type lets tests replace
+	Inject bool     // the suite can assign the field of its sut
+	Paths  []string // files the code opens in it by literal names, sorted
+}
+
+// fsMethods are the methods of the io/fs interfaces and embed.FS naming a
+// file as their first argument.
+var fsMethods = map[string]bool{"Open": true, "ReadFile": true, "ReadDir": true, "Stat": true, "Sub": true}
+
+// isFSType reports whether typ is embed.FS or one of the io/fs file system
+// interfaces, which a fstest.MapFS implements.
+func isFSType(typ string, imports map[string]string) (fsType, embedded bool) {
+	qual, name, ok := strings.Cut(typ, ".")
+	if !ok {
+		return false, false
+	}
+	switch imports[qual] {
+	case "embed":
+		return name == "FS", name == "FS"
+	case "io/fs":
+		return strings.HasSuffix(name, "FS"), false
+	}
+	return false, false
+}
+
+// collectFSPaths records the literal names body opens files by in each
+// file system: `recv.field.ReadFile("a.txt")` under the field, and
+// `fs.ReadFile(fsys, "a.txt")` or `fsys.Open("a.txt")` under the
+// identifier fsys.
+func collectFSPaths(body *ast.BlockStmt, recv string, imports map[string]string) map[string][]string {
+	paths := make(map[string][]string)
+	add := func(fsys ast.Expr, arg ast.Expr, dir bool) {
+		lit, ok := arg.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return
+		}
+		name, err := strconv.Unquote(lit.Value)
+		if err != nil || name == "." {
+			return
+		}
+		if dir {
+			name += "/"
+		}
+		key := ""
+		switch x := fsys.(type) {
+		case *ast.Ident:
+			key = x.Name
+		case *ast.SelectorExpr:
+			if id, ok := x.X.(*ast.Ident); ok && recv != "" && id.Name == recv {
+				key = x.Sel.Name
+			}
+		}
+		if key != "" {
+			paths[key] = append(paths[key], name)
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || !fsMethods[sel.Sel.Name] {
+			return true
+		}
+		// a directory is marked with a trailing slash, to hold a file in the MapFS
+		dir := sel.Sel.Name == "ReadDir" || sel.Sel.Name == "Sub"
+		if pkg, ok := sel.X.(*ast.Ident); ok && imports[pkg.Name] == "io/fs" {
+			if len(call.Args) == 2 {
+				add(call.Args[0], call.Args[1], dir)
+			}
+		} else if len(call.Args) == 1 {
+			add(sel.X, call.Args[0], dir)
+		}
+		return true
+	})
+	return paths
+}
+
+// detectFS finds the file system fields of si, and the file system
+// parameters of its methods, with the files the code opens in them.
+func detectFS(si *StructInfo, imports map[string]string) {
+	for _, field := range si.Fields {
+		fsType, embedded := isFSType(field.Type, imports)
+		if !fsType || field.Name == "" {
+			continue
+		}
+		dep := FSDep{Name: field.Name, Embed: embedded, Inject: !embedded}
+		for _, fn := range si.Methods {
+			dep.Paths = append(dep.Paths, fn.FSPaths[field.Name]...)
+		}
+		dep.Paths = uniqueSorted(dep.Paths)
+		si.FSFields = append(si.FSFields, dep)
+	}
+	for i := range si.Methods {
+		fn := &si.Methods[i]
+		for _, p := range fn.Params {
+			if fsType, _ := isFSType(p.Type, imports); fsType && p.Name != "" && p.Name != "_" {
+				fn.FSParams = append(fn.FSParams, FSDep{Name: p.Name, Paths: uniqueSorted(fn.FSPaths[p.Name])})
+			}
+		}
+	}
+}
+
+// Entries are the files of the MapFS standing in for d: the paths the code
+// opens, and a placeholder in each directory it lists.
+func (d FSDep) Entries() []string {
+	entries := make([]string, len(d.Paths))
+	for i, p := range d.Paths {
+		if strings.HasSuffix(p, "/") {
+			p += "placeholder.txt"
+		}
+		entries[i] = p
+	}
+	return entries
+}
+
+func uniqueSorted(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// templateFuncs are the helpers available to the embedded templates and to
+// custom ones supplied with -templates.
+var templateFuncs = template.FuncMap{
+	"quote":       strconv.Quote,
+	"branch":      newBranchContext,
+	"path":        newPathContext,
+	"flat":        func() bool { return *flatten },
+	"method":      newMethodContext,
+	"join":        strings.Join,
+	"oneLine":     func(s string) string { return strings.Join(strings.Fields(s), " ") },
+	"upperFirst":  upperFirst,
+	"lowerFirst":  lowerFirst,
+	"camelCase":   identifier,
+	"snakeCase":   snakeCase,
+	"slug":        slug,
+	"receiverVar": receiverVar,
+	"zeroValue":   zeroValue,
+	"zeroArgs":    zeroArgs,
+	"isErrorType": isErrorType,
+	"pluralize":   pluralize,
+	"indent":      indent,
+	"isRecvChan":  isRecvChan,
+	"isFuncType":  isFuncType,
+	"isIter":      isIter,
+	"callValue":   callValue,
+	"flatten":     flattenBranches,
+	"leafPaths":   leafPaths,
+	"returnsOnly": returnsOnly,
+	"depth":       branchDepth,
+	"dataTag":     dataTag,
+	"dataDecode":  dataDecode,
+	"deadline":    func() string { return durationExpr(*deadline) },
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// identifier turns a file name such as "my_file_branch" into a lower
+// camel-case Go identifier, "myFileBranch".
+func identifier(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = b.Len() > 0
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			b.WriteByte('x')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return lowerFirst(b.String())
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// zeroValue returns an expression for the zero value of the type spelled typ.
+func zeroValue(typ string) string {
+	switch typ {
+	case "string":
+		return `""`
+	case "bool":
+		return "false"
+	case "error", "any", "interface{}":
+		return "nil"
+	case "byte", "rune", "uintptr",
+		"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "complex64", "complex128":
+		return "0"
+	}
+	for _, prefix := range []string{"*", "[]", "map[", "chan ", "<-chan", "func(", "interface{"} {
+		if strings.HasPrefix(typ, prefix) {
+			return "nil"
+		}
+	}
+	return "*new(" + typ + ")"
+}
+
+// zeroArgs renders a call's argument list passing the zero value of every
+// parameter, and n zero values to a trailing variadic parameter.
+func zeroArgs(params []Field, n int) string {
+	args := make([]string, 0, len(params)+n)
+	for _, param := range params {
+		if param.Variadic {
+			for range n {
+				args = append(args, zeroValue(param.Elem()))
+			}
+			break
+		}
+		args = append(args, zeroValue(param.Type))
+	}
+	return strings.Join(args, ", ")
+}
+
+// snakeCase turns an identifier such as "HTTPServerConfig" into
+// "http_server_config".
+func snakeCase(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && !strings.HasSuffix(b.String(), "_") {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// caseOperators spells out the operators of a condition in words, nil
+// comparisons first so they are not split up by the bare operators.
+var caseOperators = strings.NewReplacer(
+	" != nil", " is not nil",
+	" == nil", " is nil",
+	" && ", " and ",
+	" || ", " or ",
+	" != ", " is not ",
+	" == ", " is ",
+	" <= ", " is at most ",
+	" >= ", " is at least ",
+	" < ", " is less than ",
+	" > ", " is greater than ",
+)
+
+// maxCaseName is the length past which case names are cut short.
+const maxCaseName = 60
+
+// caseName turns a branch's code into a readable subtest name:
+// `if err != nil` becomes "err is not nil". Names longer than maxCaseName
+// are truncated and suffixed with the branch's line, which keeps them unique.
+func caseName(code string, line int) string {
+	code = strings.Join(strings.Fields(code), " ")
+	if inner, ok := strings.CutPrefix(code, "else // of ["); ok {
+		inner = inner[:strings.LastIndex(inner, "]")]
+		return "not (" + caseName(inner, line) + ")"
+	}
+	if i := strings.Index(code, " //"); i >= 0 {
+		code = code[:i]
+	}
+	code = strings.TrimPrefix(code, "else ")
+	code = strings.TrimPrefix(code, "if ")
+	code = strings.TrimSuffix(code, ":")
+	return shortName(caseOperators.Replace(code), line)
+}
+
+// shortName cuts a case name longer than maxCaseName at a word, marking it
+// with the line of the branch so it stays unique.
+func shortName(name string, line int) string {
+	if runes := []rune(name); len(runes) > maxCaseName {
+		cut := string(runes[:maxCaseName])
+		if sp := strings.LastIndexByte(cut, ' '); sp > 0 {
+			cut = cut[:sp]
+		}
+		name = cut + "... @" + strconv.Itoa(line)
+	}
+	return name
+}
+
+// slug turns free text such as a branch condition into a lower-case,
+// dash-separated name: `if err != nil` becomes "if-err-nil".
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// receiverVar returns the conventional short receiver identifier for a type,
+// its lower-cased first letter: "c" for Client.
+func receiverVar(typeName string) string {
+	for _, r := range typeName {
+		return string(unicode.ToLower(r))
+	}
+	return "x"
+}
+
+func isErrorType(typ string) bool {
+	return typ == "error"
+}
+
+// pluralize applies the regular English plural rules to a noun.
+func pluralize(s string) string {
+	lower := strings.ToLower(s)
+	switch {
+	case s == "":
+		return s
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return s + "es"
+	case strings.HasSuffix(lower, "y") && len(s) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return s[:len(s)-1] + "ies"
+	}
+	return s + "s"
+}
+
+// indent prefixes every non-empty line of s with n tabs.
+func indent(n int, s string) string {
+	pad := strings.Repeat("\t", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isRecvChan reports whether typ is a channel a test can receive from.
+func isRecvChan(typ string) bool {
+	return strings.HasPrefix(typ, "chan ") || strings.HasPrefix(typ, "chan(") || strings.HasPrefix(typ, "<-chan")
+}
+
+func isFuncType(typ string) bool {
+	return strings.HasPrefix(typ, "func(") || strings.HasPrefix(typ, "func (")
+}
+
+// callValue renders a statement invoking the function value name of type
+// typ with zero arguments and discarding its results, e.g. `_ = fn(0)`.
+func callValue(name, typ string) string {
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", typ, 0)
+	if err != nil {
+		return name + "()"
+	}
+	funcType, ok := expr.(*ast.FuncType)
+	if !ok {
+		return name + "()"
+	}
+	fn := FuncInfo{
+		Params:  extractFields(funcType.Params, fset, []byte(typ)),
+		Results: extractFields(funcType.Results, fset, []byte(typ)),
+	}
+	return fn.Discard() + name + "(" + zeroArgs(fn.Params, 0) + ")"
+}
+
+// durationExpr renders d as a Go expression, such as 5 * time.Second.
+func durationExpr(d time.Duration) string {
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "Hour"}, {time.Minute, "Minute"}, {time.Second, "Second"}, {time.Millisecond, "Millisecond"}} {
+		if d%unit.d == 0 {
+			if d == unit.d {
+				return "time." + unit.name
+			}
+			return strconv.FormatInt(int64(d/unit.d), 10) + " * time." + unit.name
+		}
+	}
+	return "time.Duration(" + strconv.FormatInt(int64(d), 10) + ")"
+}
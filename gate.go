@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// GateResult is a package's line in `twintest gate`: how many of the
+// branches twintest extracts from it a coverage profile reached.
+type GateResult struct {
+	Dir      string
+	Branches int
+	Covered  int
+}
+
+// Percent is the share of the package's branches covered; a package without
+// branches has nothing left to cover.
+func (r GateResult) Percent() float64 {
+	if r.Branches == 0 {
+		return 100
+	}
+	return 100 * float64(r.Covered) / float64(r.Branches)
+}
+
+// runGate implements `twintest gate -cover profile [-min pct] [path ...]`,
+// which fails when a package's branches are covered below -min percent.
+// Unlike go test -cover, which counts statements, it counts the return
+// paths twintest generates cases for.
+func runGate(args []string) error {
+	flags := flag.NewFlagSet("gate", flag.ExitOnError)
+	cover := flags.String("cover", "", "coverage profile from go test -coverprofile")
+	minPct := flags.Float64("min", 80, "least percentage of branches each package must cover")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest gate -cover profile [-min pct] [file.go | dir | dir/...]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *cover == "" || *minPct < 0 || *minPct > 100 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+	profile, err := readCoverProfile(*cover)
+	if err != nil {
+		return err
+	}
+	results, err := gate(files, profile)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCOVERED\tBRANCHES\tPERCENT\tPACKAGE")
+	for _, r := range results {
+		status := "ok"
+		if r.Percent() < *minPct {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%s\n", status, r.Covered, r.Branches, r.Percent(), r.Dir)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d packages cover less than %.1f%% of their branches", failed, len(results), *minPct)
+	}
+	return nil
+}
+
+// gate counts, per package directory, the leaf branches of files, which end
+// the paths twintest generates cases for, and those of them a block of
+// profile reached.
+func gate(files []string, profile coverProfile) ([]GateResult, error) {
+	byDir := make(map[string]*GateResult)
+	for _, file := range files {
+		structInfo, _, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Dir(file)
+		r := byDir[dir]
+		if r == nil {
+			r = &GateResult{Dir: dir}
+			byDir[dir] = r
+		}
+		blocks := profile.blocksFor(file)
+		for _, si := range structInfo {
+			if si.IsInterface {
+				continue
+			}
+			for _, fn := range si.Methods {
+				for _, b := range flattenBranches(fn.Branches) {
+					if len(b.Children) > 0 {
+						continue // covered through its leaves
+					}
+					r.Branches++
+					if leafReached(blocks, b) {
+						r.Covered++
+					}
+				}
+			}
+		}
+	}
+
+	results := make([]GateResult, 0, len(byDir))
+	for _, r := range byDir {
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Dir < results[j].Dir })
+	return results, nil
+}
+
+// leafReached reports whether blocks show the leaf b run. A leaf ending a
+// path, such as a return, is a statement of the block around it; an if or
+// case with an empty body is run when its body is: the last block starting
+// on its line, after the brace or colon, rather than one holding its
+// condition.
+func leafReached(blocks []coverBlock, b *Branch) bool {
+	switch b.Type {
+	case BranchReturn, BranchBreak, BranchContinue, BranchFallthrough, BranchCall, BranchPanic:
+		return reached(blocks, b.Line)
+	}
+	col, count := 0, 0 // a profile may list a block once per test binary
+	for _, block := range blocks {
+		switch {
+		case block.StartLine != b.Line || block.StartCol < col:
+		case block.StartCol > col:
+			col, count = block.StartCol, block.Count
+		default:
+			count += block.Count
+		}
+	}
+	return count > 0
+}
@@ -7,6 +7,8 @@ import (
 	"go/format"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -18,65 +20,848 @@ var suiteTemplate string
 //go:embed template/func.tmpl
 var funcTemplate string
 
-func GenerateTestFiles(src string, ss []*StructInfo, packageName string) error {
+//go:embed template/contract.tmpl
+var contractTemplate string
+
+//go:embed template/branch.tmpl
+var branchTemplate string
+
+//go:embed template/setup.tmpl
+var setupTemplate string
+
+//go:embed template/fixtures.tmpl
+var fixturesTemplate string
+
+//go:embed template/runner.tmpl
+var runnerTemplate string
+
+//go:embed template/tags.tmpl
+var tagsTemplate string
+
+//go:embed template/init.tmpl
+var initTemplate string
+
+// fixturesFile holds the helpers -fixtures shares between the suites of a package.
+const fixturesFile = "twintest_fixtures_test.go"
+
+// branchContext pairs a branch with the function it belongs to, so the
+// shared branch template can render function-dependent leaves.
+type branchContext struct {
+	*Branch
+	Func *FuncInfo
+}
+
+func newBranchContext(fn FuncInfo, b *Branch) branchContext {
+	return branchContext{Branch: b, Func: &fn}
+}
+
+// Boundary suggests the inputs on either side of the branch's condition
+// when it compares parameters with constants, as "命中 n = 101; 跳过 n = 100",
+// or "". The host of an if-else chain leaves it to its branches.
+func (c branchContext) Boundary() string {
+	if c.Type == BranchIfHost {
+		return ""
+	}
+	params := make(map[string]bool)
+	for _, p := range c.Func.Params {
+		params[p.Name] = true
+	}
+	take, skip := boundaryInputs(c.Branch, params, c.Func.Operands)
+	var parts []string
+	if len(take) > 0 {
+		parts = append(parts, "命中 "+strings.Join(take, ", "))
+	}
+	if len(skip) > 0 {
+		parts = append(parts, "跳过 "+strings.Join(skip, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// pathContext is a path from a root branch down to a leaf, which -flatten
+// renders as a single case.
+type pathContext struct {
+	Steps []branchContext // the branches along the path, less if-else hosts
+	Leaf  branchContext
+}
+
+func newPathContext(fn FuncInfo, path []*Branch) pathContext {
+	p := pathContext{Leaf: newBranchContext(fn, path[len(path)-1])}
+	for _, b := range path {
+		if b.Type != BranchIfHost {
+			p.Steps = append(p.Steps, newBranchContext(fn, b))
+		}
+	}
+	return p
+}
+
+// Name names the case after the whole chain of conditions down to the leaf.
+func (p pathContext) Name() string {
+	names := make([]string, len(p.Steps))
+	for i, step := range p.Steps {
+		names[i] = step.Name()
+	}
+	return shortName(strings.Join(names, " > "), p.Leaf.Line)
+}
+
+// PrefilledWant is an expected result of a leaf taken from its return
+// statement.
+type PrefilledWant struct {
+	Field        // the want variable and the result's type
+	Value string // the result as returned
+	Got   string // the variable the call assigns the result to
+}
+
+// Wants returns the expected results of a return made of literals, for the
+// leaf to call the function and assert them, or nil when it cannot: for
+// other branches, and for results the leaf already asserts another way.
+func (c branchContext) Wants() []PrefilledWant {
+	if !c.Func.prefills(c.Branch) {
+		return nil
+	}
+	got := c.Func.GotNames()
+	wants := c.Func.WantFields()
+	prefilled := make([]PrefilledWant, len(wants))
+	for i, w := range wants {
+		prefilled[i] = PrefilledWant{Field: w, Value: c.Returns[i], Got: got[i]}
+	}
+	return prefilled
+}
+
+// methodContext pairs a function with the struct it is a method of, for
+// top-level benchmarks and examples to construct the receiver.
+type methodContext struct {
+	Struct *StructInfo
+	Func   *FuncInfo
+}
+
+func newMethodContext(si *StructInfo, fn FuncInfo) methodContext {
+	return methodContext{Struct: si, Func: &fn}
+}
+
+// templateFiles maps template file names to the embedded templates, which a
+// -templates directory may provide replacements for.
+var templateFiles = map[string]*string{
+	"suite.tmpl":    &suiteTemplate,
+	"func.tmpl":     &funcTemplate,
+	"contract.tmpl": &contractTemplate,
+	"branch.tmpl":   &branchTemplate,
+	"setup.tmpl":    &setupTemplate,
+	"fixtures.tmpl": &fixturesTemplate,
+	"runner.tmpl":   &runnerTemplate,
+	"tags.tmpl":     &tagsTemplate,
+	"init.tmpl":     &initTemplate,
+}
+
+// loadTemplate returns the user's replacement for the named template when
+// the -templates directory holds one, or the embedded template otherwise.
+// A -templates directory that does not exist is an error, rather than the
+// embedded templates silently standing in for all of them.
+func loadTemplate(name string) (string, error) {
+	if *tmplDir == "" {
+		return *templateFiles[name], nil
+	}
+	if info, err := os.Stat(*tmplDir); err != nil {
+		return "", fmt.Errorf("-templates: %w", err)
+	} else if !info.IsDir() {
+		return "", fmt.Errorf("-templates: %s is not a directory", *tmplDir)
+	}
+	text, err := os.ReadFile(filepath.Join(*tmplDir, name))
+	if os.IsNotExist(err) {
+		return *templateFiles[name], nil
+	} else if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+// GenerateTestFiles renders a test file for each of ss next to src, and
+// returns their paths.
+func GenerateTestFiles(src string, ss []*StructInfo, packageName string) ([]string, error) {
 	absPath, err := filepath.Abs(src)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	dir := filepath.Dir(absPath)
 	base := filepath.Base(absPath)
 
+	banner, err := loadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	report := func(file string, written bool) {
+		files = append(files, file)
+		if written {
+			logEvent(status, eventGenerated, "Generated "+file, "file", file, "source", src)
+		} else {
+			logEvent(status, eventUnchanged, "Unchanged "+file, "file", file, "source", src)
+		}
+	}
+
+	// synctest.Test came with Go 1.25
+	synctest := moduleGoAtLeast(dir, 25)
+
+	suites := false
+	claimed := make(map[string]string)
 	for i := range ss {
 		si := ss[i]
+		for j := range si.Methods {
+			si.Methods[j].Synctest = synctest && !si.IsInterface && si.Methods[j].UsesTimers()
+		}
+		si.Fixtures = *fixture && !si.BlackBox
+		si.Runner = *runner && !si.BlackBox
+		if !si.IsInterface && si.Name != "" {
+			testPackage := packageName
+			if si.BlackBox {
+				testPackage += "_test"
+			}
+			if si.Base, err = findBaseSuite(dir, testPackage); err != nil {
+				return files, err
+			}
+		}
+		if si.Init != nil {
+			initFile := strings.TrimSuffix(base, ".go") + "_init_test.go"
+			if other, ok := claimed[initFile]; ok {
+				return files, fmt.Errorf("%s: the tests of %s and the init functions would both go in %s", src, other, initFile)
+			}
+			claimed[initFile] = "the init functions"
+			written, err := generatePackageFile("init.tmpl", filepath.Join(dir, initFile), initFileData{
+				Generated:   generatedLine(),
+				PackageName: packageName,
+				Source:      base,
+				Name:        identifier(strings.TrimSuffix(base, ".go")),
+				InitEffects: si.Init,
+			}, banner)
+			if err != nil {
+				return files, err
+			}
+			report(filepath.Join(dir, initFile), written)
+			if len(si.Methods) == 0 && si.Templates == nil {
+				continue // init is all the file has to test
+			}
+		}
+		suites = suites || !si.IsInterface && !si.BlackBox
 
 		outFile := strings.TrimSuffix(base, ".go") // + "_test.go"
 		if si.Name == "" {
 			outFile = fmt.Sprintf("%s_branch_test.go", outFile)
+		} else if si.IsInterface {
+			outFile = fmt.Sprintf("%s_%s_contract_test.go", outFile, strings.ToLower(si.Name))
 		} else {
 			outFile = fmt.Sprintf("%s_%s_suite_test.go", outFile, strings.ToLower(si.Name))
 		}
+		if si.File != "" {
+			if si.File != filepath.Base(si.File) || !strings.HasSuffix(si.File, "_test.go") {
+				return files, fmt.Errorf("%s: //twintest:file=%s on %s must name a _test.go file in the same directory", src, si.File, si.Name)
+			}
+			if si.File == fixturesFile || si.File == runnerFile || si.File == tagsFile {
+				return files, fmt.Errorf("%s: //twintest:file=%s on %s names a file twintest keeps for the package", src, si.File, si.Name)
+			}
+			// a hand-written test file is not twintest's to overwrite
+			file := filepath.Join(dir, si.File)
+			if _, err := os.Stat(file); err == nil && *output == "files" && !isGenerated(file) {
+				return files, fmt.Errorf("%s: //twintest:file=%s on %s names a test file twintest did not generate", src, si.File, si.Name)
+			}
+			outFile = si.File
+		}
+		if other, ok := claimed[outFile]; ok {
+			return files, fmt.Errorf("%s: the tests of %s and %s would both go in %s", src, other, si.Name, outFile)
+		}
+		claimed[outFile] = si.Name
+		if si.Name == "" {
+			claimed[outFile] = "the package functions"
+		}
 
 		outFile = filepath.Join(dir, outFile)
 
-		err = GenerateTestFile(outFile, si, packageName)
+		if sharded(si) {
+			if err := generateShards(outFile, si, packageName, banner, report); err != nil {
+				return files, err
+			}
+		} else {
+			written, err := GenerateTestFile(outFile, si, packageName, banner)
+			if err != nil {
+				return files, err
+			}
+			report(outFile, written)
+			if si.Name != "" && !si.IsInterface && !si.Partial {
+				if err := removeStaleShards(outFile, 0); err != nil {
+					return files, err
+				}
+			}
+		}
+		if err := writeDataFiles(dir, si, report); err != nil {
+			return files, err
+		}
+		if err := writeReadFiles(dir, si, report); err != nil {
+			return files, err
+		}
+	}
+
+	if *fixture && suites {
+		outFile := filepath.Join(dir, fixturesFile)
+		written, err := generateFixtures(outFile, packageName, banner)
+		if err != nil {
+			return files, err
+		}
+		report(outFile, written)
+	}
+
+	if *runner {
+		outFile := filepath.Join(dir, runnerFile)
+		suiteNames, err := runnerSuites(dir, ss)
 		if err != nil {
-			return err
+			return files, err
+		}
+		if len(suiteNames) > 0 {
+			written, err := generatePackageFile("runner.tmpl", outFile, packageFileData{
+				Generated:   generatedLine(),
+				PackageName: packageName,
+				Suites:      suiteNames,
+			}, banner)
+			if err != nil {
+				return files, err
+			}
+			report(outFile, written)
 		}
+	}
+
+	if *tagCheck {
+		outFile := filepath.Join(dir, tagsFile)
+		tags := config.Tags.withDefaults()
+		structs, err := taggedStructs(dir, packageName, tags.Keys)
+		if err != nil {
+			return files, err
+		}
+		if len(structs) > 0 {
+			written, err := generatePackageFile("tags.tmpl", outFile, packageFileData{
+				Generated:   generatedLine(),
+				PackageName: packageName,
+				Structs:     structs,
+				Tags:        tags,
+			}, banner)
+			if err != nil {
+				return files, err
+			}
+			report(outFile, written)
+		}
+	}
+	return files, nil
+}
+
+// generateFixtures renders the helpers shared by the suites of a package.
+// They are the same whichever suites use them, so every run agrees on them.
+func generateFixtures(filename, packageName string, banner []byte) (bool, error) {
+	return generatePackageFile("fixtures.tmpl", filename, packageFileData{
+		Generated:   generatedLine(),
+		PackageName: packageName,
+	}, banner)
+}
+
+// packageFileData is what the templates of the per-package files see.
+type packageFileData struct {
+	Generated   string
+	PackageName string
+	Suites      []string // suite types the runner registers, sorted
+	Structs     []string // struct types whose tags are checked, sorted
+	Tags        TagsConfig
+}
+
+// initFileData is what the template of the init test of a file sees.
+type initFileData struct {
+	Generated   string
+	PackageName string
+	Source      string // base name of the source file
+	Name        string // the source file as an identifier, naming the test apart from those of other files
+	*InitEffects
+}
+
+// generatePackageFile renders one of the files twintest keeps per package,
+// rather than per source file, into filename; or another file standing on
+// its own template, such as the init test of a file.
+func generatePackageFile(tmplFile, filename string, data any, banner []byte) (bool, error) {
+	text, err := loadTemplate(tmplFile)
+	if err != nil {
+		return false, err
+	}
+	tmpl, err := template.New("package").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", tmplFile, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return false, err
+	}
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		formatted = buf.Bytes()
+	}
+	content, err := postProcess(filename, append(append([]byte(nil), banner...), formatted...))
+	if err != nil {
+		return false, err
+	}
+	return writeGenerated(filename, content)
+}
+
+// loadHeader reads the -header file, ending it with a blank line so it stands
+// apart from the generated code.
+func loadHeader() ([]byte, error) {
+	if *header == "" {
+		return nil, nil
+	}
+	text, err := os.ReadFile(*header)
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes.TrimRight(text, "\n"), "\n\n"...), nil
+}
+
+// generatedLine is the first line of every generated file. With -marker it
+// follows the convention tools use to recognise generated code, unless -merge
+// says the files are edited by hand.
+func generatedLine() string {
+	if *marker && !*merge {
+		return generatedBy[0] + ". DO NOT EDIT."
+	}
+	return generatedBy[1] + "."
+}
 
-		fmt.Printf("Generated %s\n", outFile)
+// GenerateTestFile renders si into filename, as writeGenerated writes it;
+// written reports whether the file was (re)written.
+func GenerateTestFile(filename string, si *StructInfo, packageName string, banner []byte) (written bool, err error) {
+	formatted, err := renderTestFile(filename, si, packageName)
+	if err != nil {
+		return false, err
+	}
+
+	content, err := postProcess(filename, append(append([]byte(nil), banner...), formatted...))
+	if err != nil {
+		return false, err
+	}
+	if si.Partial {
+		if old, err := os.ReadFile(filename); err == nil {
+			if content, err = spliceTest(old, content); err != nil {
+				return false, fmt.Errorf("%s: %w", filename, err)
+			}
+		}
 	}
-	return nil
+	return writeGenerated(filename, content)
 }
 
-func GenerateTestFile(filename string, si *StructInfo, packageName string) error {
+// renderTestFile executes the templates for si, to go in filename, and
+// formats the result.
+func renderTestFile(filename string, si *StructInfo, packageName string) (formatted []byte, err error) {
+	collectImports(si)
+
+	testPackage := packageName
+	if si.BlackBox {
+		testPackage += "_test"
+	}
+
+	prefix := lowerFirst(si.Name)
+	if prefix == "" {
+		prefix = identifier(strings.TrimSuffix(filepath.Base(filename), "_test.go"))
+	}
+
 	data := struct {
+		Generated   string
 		PackageName string
 		StructInfo  *StructInfo
+		Prefix      string // unexported identifier prefix unique to this file
 	}{
-		PackageName: packageName,
+		Generated:   generatedLine(),
+		PackageName: testPackage,
 		StructInfo:  si,
+		Prefix:      prefix,
 	}
 
-	tmplFile := suiteTemplate
+	tmplFile := "suite.tmpl"
 	if si.Name == "" {
-		tmplFile = funcTemplate
+		tmplFile = "func.tmpl"
+	} else if si.IsInterface {
+		tmplFile = "contract.tmpl"
 	}
 
-	tmpl := template.Must(template.New("test").Funcs(template.FuncMap{
-		"quote": strconv.Quote,
-	}).Parse(tmplFile))
+	tmpl := template.New("test").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"prefix": func() string { return prefix },
+	})
+	for _, name := range []string{tmplFile, "branch.tmpl", "setup.tmpl"} {
+		text, err := loadTemplate(name)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl, err = tmpl.Parse(text); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
-		return err
+		return nil, err
+	}
+	code := buf.Bytes()
+	if si.BlackBox {
+		if code, err = qualifyBlackBox(code, filepath.Dir(filename), packageName); err != nil {
+			return nil, err
+		}
 	}
 
-	formatted, err := format.Source(buf.Bytes())
-	if err != nil {
+	if formatted, err = format.Source(code); err != nil {
 		// If formatting fails, use raw bytes (helpful for debugging)
-		formatted = buf.Bytes()
+		formatted = code
 	}
+	return formatted, nil
+}
 
-	return os.WriteFile(filename, formatted, 0644)
+// writeGenerated sends the content of a generated file where -output and
+// -merge direct. Identical input renders identical output, so an up-to-date
+// file is left alone, mtime included; written reports whether it was
+// (re)written.
+func writeGenerated(filename string, content []byte) (written bool, err error) {
+	if *output != "files" {
+		return true, streamFile(filename, content)
+	}
+	if *merge {
+		return writeMerged(filename, content)
+	}
+	if old, err := os.ReadFile(filename); err == nil && bytes.Equal(old, content) {
+		return false, nil
+	}
+	return true, os.WriteFile(filename, content, 0644)
+}
+
+// addImport records an import the generated file needs, once. The local name
+// is only spelled out when it differs from the pathName of path.
+func (si *StructInfo) addImport(name, path string) {
+	spec := strconv.Quote(path)
+	if name != "" && name != pathName(path) {
+		spec = name + " " + spec
+	}
+	for _, imp := range si.Imports {
+		if imp == spec {
+			return
+		}
+	}
+	si.Imports = append(si.Imports, spec)
+}
+
+// majorVersion matches the last path element of a module's major version.
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// pathName is the name a package imported as path goes by: the last element
+// of the path, less a version suffix such as the one of gopkg.in/yaml.v3 or
+// example.com/mod/v2.
+func pathName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && majorVersion.MatchString(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndexByte(name, '-'); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// qualifierPattern matches package qualifiers inside type expressions.
+var qualifierPattern = regexp.MustCompile(`\b([A-Za-z_]\w*)\.`)
+
+// addTypeImports records the imports needed to spell typ, or any expression
+// copied from the source, in the generated file.
+func (si *StructInfo) addTypeImports(typ string) {
+	for _, m := range qualifierPattern.FindAllStringSubmatch(typ, -1) {
+		if path, ok := si.fileImports[m[1]]; ok {
+			si.addImport(m[1], path)
+		}
+	}
+}
+
+// addArgImports records the imports of the arguments zeroArgs renders for
+// params, passing n values to a variadic one: only those it spells as
+// *new(T) name their type, nil and literals need no import. The params in
+// passed are given a variable of the test instead, as Args does.
+func (si *StructInfo) addArgImports(params []Field, n int, passed map[string]bool) {
+	for _, param := range params {
+		if passed[param.Name] && !param.Variadic {
+			continue
+		}
+		typ := param.Type
+		if param.Variadic {
+			if n == 0 {
+				break
+			}
+			typ = param.Elem()
+		}
+		if strings.HasPrefix(zeroValue(typ), "*new(") {
+			si.addTypeImports(typ)
+		}
+	}
+}
+
+// collectImports works out the imports the generated file needs beyond the
+// fixed ones, from what survived trimming, so none of them go unused.
+func collectImports(si *StructInfo) {
+	si.Imports = nil
+	defer func() { sort.Strings(si.Imports) }()
+	for i := range si.Methods {
+		method := &si.Methods[i]
+		panics := false
+		for _, b := range flattenBranches(method.Branches) {
+			for _, expr := range b.Wraps {
+				si.addTypeImports(expr)
+			}
+			if method.prefills(b) {
+				for i, r := range method.Results {
+					si.addTypeImports(r.Type)
+					si.addTypeImports(b.Returns[i])
+				}
+				si.addArgImports(method.Params, 0, method.scaffolded())
+			}
+			panics = panics || b.Type == BranchPanic
+		}
+		for _, c := range method.Cases {
+			si.addTypeImports(c.Want)
+		}
+		if method.ReturnsChan() || method.ReturnsFunc() {
+			for _, result := range method.Results {
+				si.addTypeImports(result.Type)
+			}
+		}
+		if method.HasIters() {
+			for _, seq := range method.IterSeqs() {
+				si.addTypeImports(seq.Type)
+				if seq.Elem == "" {
+					si.addImport("", "slices")
+				}
+			}
+		}
+		if method.Binary != nil {
+			for _, path := range []string{"errors", "os/exec", "path/filepath"} {
+				si.addImport("", path)
+			}
+		}
+		if method.Cobra != nil {
+			si.addImport("", "bytes")
+			for _, param := range method.Params {
+				si.addTypeImports(param.Type)
+			}
+		}
+		if h := method.Handler; h != nil {
+			si.addImport("", "net/http")
+			si.addImport("", "net/http/httptest")
+			si.addTypeImports(method.Params[0].Type)
+			if h.Router == "chi" {
+				si.addImport("", "context")
+				si.addImport(h.Pkg, si.fileImports[h.Pkg])
+			}
+		}
+		if method.HasChans() {
+			si.addImport("", "time")
+			for _, param := range method.Params {
+				if !param.Variadic {
+					si.addTypeImports(param.Type)
+				}
+			}
+		}
+		if method.Compare != "" {
+			leaf := anyBranch(method.Branches, func(b *Branch) bool { return len(b.Children) == 0 })
+			if leaf {
+				si.addTypeImports(method.Compare)
+			}
+			if leaf || len(method.Specs) > 0 {
+				si.addImport("", "github.com/google/go-cmp/cmp")
+				for _, opt := range method.CmpOpts {
+					switch pkg, _, _ := strings.Cut(opt, "."); pkg {
+					case "cmpopts":
+						si.addImport("", "github.com/google/go-cmp/cmp/cmpopts")
+					case "protocmp":
+						si.addImport("", "google.golang.org/protobuf/testing/protocmp")
+					}
+					if strings.Contains(opt, "time.Second") {
+						si.addImport("", "time")
+					}
+				}
+			}
+		}
+		if method.Recursive {
+			si.addImport("", "time")
+		}
+		if method.Hot != nil {
+			si.addArgImports(method.Params, 0, nil) // the benchmark passes zero values
+		} else if method.Recursive || panics {
+			si.addArgImports(method.Params, 0, method.scaffolded())
+		}
+		if v := method.Variadic(); v != nil {
+			if len(method.Options) > 0 {
+				si.addTypeImports(v.Elem()) // the table's opts field
+				si.addArgImports(method.Params[:len(method.Params)-1], 0, method.scaffolded())
+			} else {
+				si.addArgImports(method.Params, 2, method.scaffolded())
+			}
+		}
+		for _, opt := range method.Options {
+			si.addArgImports(opt.Params, 0, nil)
+		}
+		for _, spec := range method.Specs {
+			si.addTypeImports(spec.Values)
+			for _, field := range method.ArgFields() {
+				si.addTypeImports(field.Type)
+			}
+			for _, result := range method.Results {
+				si.addTypeImports(result.Type)
+			}
+		}
+		if method.DataFiles {
+			for _, path := range []string{"os", "path/filepath", "strings"} {
+				si.addImport("", path)
+			}
+			if *dataFiles == "yaml" {
+				si.addImport("", "gopkg.in/yaml.v3")
+			} else {
+				si.addImport("", "encoding/json")
+			}
+			for _, field := range method.ArgFields() {
+				si.addTypeImports(field.Type)
+			}
+			for _, result := range method.Results {
+				si.addTypeImports(result.Type)
+			}
+		}
+		if method.Synctest && anyBranch(method.Branches, func(b *Branch) bool { return len(b.Children) == 0 }) {
+			si.addImport("", "testing/synctest")
+		}
+		if len(method.FSParams) > 0 {
+			si.addImport("", "testing/fstest")
+		}
+		if len(method.ReadPaths) > 0 {
+			si.addImport("", "os")
+			si.addImport("", "path/filepath")
+		}
+		if method.TouchesFS() && len(method.PathParams()) > 0 {
+			si.addImport("", "path/filepath")
+		}
+		if len(method.EnvVars) > 0 {
+			si.addImport("", "os")
+		}
+		if method.CtxParam != "" {
+			si.addImport("", "context")
+			si.addImport("", "time")
+			for _, param := range method.Params {
+				if !param.Variadic {
+					si.addTypeImports(param.Type)
+				}
+			}
+		}
+	}
+
+	if si.IO != nil && si.IO.Reader {
+		si.addImport("", "errors")
+		si.addImport("", "io")
+		si.addImport("", "testing/iotest")
+		if si.IO.Source != "" {
+			si.addImport("", "strings")
+		}
+	}
+	if si.IO != nil && si.IO.Writer {
+		si.addImport("", "bytes")
+		si.addImport("", "testing/iotest")
+	}
+
+	if si.SetsFlags() {
+		si.addImport("", "flag")
+	}
+	if si.Templates != nil {
+		si.addImport("", "bytes")
+		si.addImport("", si.Templates.Pkg)
+		si.addTypeImports(si.Templates.Data)
+	}
+	if si.HasDeadline() {
+		si.addImport("", "context")
+		si.addImport("", "time")
+	}
+	if concurrent := si.Concurrent(); len(concurrent) > 0 {
+		si.addImport("", "sync")
+		for _, fn := range concurrent {
+			for _, param := range fn.Params {
+				si.addTypeImports(param.Type)
+			}
+		}
+	}
+
+	if si.Ctor != nil {
+		for _, param := range si.Ctor.Params {
+			si.addTypeImports(param.Type)
+		}
+	}
+	for _, fn := range si.ConstructorTests() {
+		for _, param := range fn.Params {
+			si.addTypeImports(param.Type)
+		}
+		for _, opt := range fn.Options {
+			for _, param := range opt.Params {
+				si.addTypeImports(param.Type)
+			}
+		}
+	}
+
+	if si.IsInterface {
+		for i := range si.Methods {
+			for _, param := range si.Methods[i].Params {
+				si.addTypeImports(param.Type)
+			}
+		}
+		return
+	}
+	if si.Name == "" {
+		return
+	}
+
+	switch si.Logger {
+	case "slog":
+		si.addImport("", "bytes")
+		si.addImport("", "log/slog")
+	case "logrus":
+		si.addImport("", "github.com/sirupsen/logrus")
+		si.addImport("logrustest", "github.com/sirupsen/logrus/hooks/test")
+	case "zap":
+		si.addImport("", "go.uber.org/zap")
+		si.addImport("", "go.uber.org/zap/zaptest")
+	}
+	if si.FakeClock {
+		si.addImport("", "time")
+	}
+	if si.HasJSON() {
+		si.addImport("", "encoding/json")
+	}
+	if len(si.FSFields) > 0 {
+		si.addImport("", "testing/fstest")
+	}
+	if si.Rand != "" {
+		si.addImport("rand", si.Rand)
+	}
+	if si.SQL {
+		si.addImport("", "database/sql")
+		si.addImport("", "github.com/DATA-DOG/go-sqlmock")
+		for _, method := range si.Methods {
+			if method.UsesSQL && len(method.Queries) > 0 && anyBranch(method.Branches, func(b *Branch) bool { return len(b.Children) == 0 }) {
+				si.addImport("", "regexp")
+			}
+		}
+	}
+	if si.HTTP {
+		si.addImport("", "net/http")
+		si.addImport("", "net/http/httptest")
+	}
+	for _, f := range si.FuncFields {
+		si.addTypeImports(f.Type)
+	}
+	si.addTypeImports(si.TypeParams)
+	for _, inst := range si.Instances {
+		si.addTypeImports(inst)
+	}
 }
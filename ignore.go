@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile lists, in gitignore syntax, what directory traversals skip. It
+// is looked for in the directory walked and its parents.
+const ignoreFile = ".twintestignore"
+
+// ignorePattern is one line of a .twintestignore.
+type ignorePattern struct {
+	glob     string // slash-separated, "**" matching any number of directories
+	negate   bool   // "!" re-includes what an earlier pattern excluded
+	dirOnly  bool   // a trailing "/" only matches directories
+	anchored bool   // a "/" before the end matches from the ignore file's directory only
+}
+
+// ignoreRules are the patterns of a .twintestignore, which apply to paths
+// below its directory. A nil *ignoreRules ignores nothing.
+type ignoreRules struct {
+	base     string
+	patterns []ignorePattern
+}
+
+// loadIgnore reads the nearest .twintestignore at or above dir, or returns
+// nil if there is none.
+func loadIgnore(dir string) (*ignoreRules, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.Open(filepath.Join(dir, ignoreFile))
+		if err == nil {
+			defer f.Close()
+			return parseIgnore(dir, f)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func parseIgnore(base string, f *os.File) (*ignoreRules, error) {
+	rules := &ignoreRules{base: base}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var p ignorePattern
+		if line, p.negate = strings.CutPrefix(line, "!"); p.negate && line == "" {
+			continue
+		}
+		line, p.dirOnly = strings.CutSuffix(line, "/")
+		p.anchored = strings.Contains(line, "/")
+		p.glob = strings.TrimPrefix(line, "/")
+		if strings.HasPrefix(p.glob, "**/") {
+			p.anchored = true // "**/" already matches at any depth
+		}
+		rules.patterns = append(rules.patterns, p)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored reports whether the rules exclude path, directly or through one of
+// its parent directories. The last pattern that matches decides, as in git.
+func (r *ignoreRules) ignored(p string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(r.base, abs)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	// a file inside an excluded directory stays excluded, whatever else matches it
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if r.match(dir, true) {
+			return true
+		}
+	}
+	return r.match(rel, isDir)
+}
+
+func (r *ignoreRules) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range r.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		name := rel
+		if !p.anchored {
+			name = path.Base(rel)
+		}
+		if matchGlob(strings.Split(p.glob, "/"), strings.Split(name, "/")) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matchGlob matches path segments against pattern segments, where "**"
+// stands for any number of segments and the others are path.Match patterns.
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], segments[1:])
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// InitEffects are the side effects of the init functions of a file. They
+// run before any test and cannot be called from one, so rather than a test
+// of its own, init gets one asserting the state it leaves.
+type InitEffects struct {
+	Flags   []CLIFlag  // flags registered on the command line
+	Entries []MapEntry // entries put in package-level maps
+	Globals []string   // package variables otherwise assigned
+	Calls   []string   // functions of other packages called, such as sql.Register
+}
+
+// MapEntry is an entry init puts in a package-level map under a key known
+// before it runs.
+type MapEntry struct {
+	Map string
+	Key string // the key as in the source
+}
+
+// collectInitEffects returns the side effects of the init functions of
+// node, or nil when it has none or they have none found.
+func collectInitEffects(node *ast.File, imports map[string]string, globals map[*ast.ValueSpec]bool) *InitEffects {
+	e := &InitEffects{}
+	seen := make(map[string]bool)
+	for _, decl := range node.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !isInit(fn) || fn.Body == nil {
+			continue
+		}
+		e.Flags = append(e.Flags, collectFlags(fn.Body, imports)...)
+
+		entries := make(map[string]bool)
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false // run later, if at all
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					index, ok := lhs.(*ast.IndexExpr)
+					if !ok || !isConstKey(index.Index) {
+						continue
+					}
+					m, ok := index.X.(*ast.Ident)
+					if !ok || m.Obj == nil || m.Obj.Kind != ast.Var {
+						continue
+					}
+					if spec, ok := m.Obj.Decl.(*ast.ValueSpec); !ok || !globals[spec] {
+						continue
+					}
+					entry := MapEntry{Map: m.Name, Key: types.ExprString(index.Index)}
+					entries[m.Name] = true
+					if !seen[entry.Map+"["+entry.Key+"]"] {
+						seen[entry.Map+"["+entry.Key+"]"] = true
+						e.Entries = append(e.Entries, entry)
+					}
+				}
+			case *ast.ExprStmt:
+				call, ok := n.X.(*ast.CallExpr)
+				if !ok {
+					break
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok {
+					break
+				}
+				if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && imports[x.Name] != "" && imports[x.Name] != "flag" {
+					name := types.ExprString(sel)
+					if !seen[name] {
+						seen[name] = true
+						e.Calls = append(e.Calls, name)
+					}
+				}
+			}
+			return true
+		})
+
+		for _, name := range collectGlobalWrites(fn.Body, globals) {
+			if !entries[name] && !seen[name] {
+				seen[name] = true
+				e.Globals = append(e.Globals, name)
+			}
+		}
+	}
+	if len(e.Flags)+len(e.Entries)+len(e.Globals)+len(e.Calls) == 0 {
+		return nil
+	}
+	return e
+}
+
+// isInit reports whether fn is an init function, which runs on its own and
+// which no test can call.
+func isInit(fn *ast.FuncDecl) bool {
+	return fn.Recv == nil && fn.Name.Name == "init"
+}
+
+// isConstKey reports whether a map key is known before init runs: a literal
+// or a constant, rather than a loop variable or a computed value.
+func isConstKey(key ast.Expr) bool {
+	switch k := key.(type) {
+	case *ast.BasicLit:
+		return true
+	case *ast.Ident:
+		return k.Obj == nil || k.Obj.Kind == ast.Con
+	case *ast.SelectorExpr:
+		x, ok := k.X.(*ast.Ident)
+		return ok && x.Obj == nil // a constant of another package
+	}
+	return false
+}
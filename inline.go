@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// inlineCalls appends to every function the return-relevant branches of the
+// package functions and receiver methods it calls, following calls depth
+// levels deep, so thin orchestrators get the cases of their helpers. Helpers
+// are looked up in src and the other files of its package.
+func inlineCalls(structInfo []*StructInfo, src, packageName string, depth int) error {
+	funcs := make(map[string]*FuncInfo)
+	addFuncs := func(structs []*StructInfo) {
+		for _, si := range structs {
+			if si.IsInterface {
+				continue
+			}
+			for i := range si.Methods {
+				if _, ok := funcs[si.Methods[i].key()]; !ok {
+					funcs[si.Methods[i].key()] = &si.Methods[i]
+				}
+			}
+		}
+	}
+	addFuncs(structInfo)
+
+	siblings, err := sourceFiles([]string{filepath.Dir(src)})
+	if err != nil {
+		return err
+	}
+	for _, file := range siblings {
+		if filepath.Base(file) == filepath.Base(src) {
+			continue
+		}
+		structs, pkg, err := ParseFile(file)
+		if err != nil {
+			return err
+		}
+		if pkg == packageName {
+			addFuncs(structs)
+		}
+	}
+
+	// the expansions are computed before any is attached, so helpers in this
+	// file are inlined as written rather than already expanded
+	expansions := make(map[*FuncInfo][]*Branch)
+	for _, si := range structInfo {
+		for i := range si.Methods {
+			fn := &si.Methods[i]
+			expansions[fn] = inlined(fn, funcs, depth, map[string]bool{fn.key(): true})
+		}
+	}
+	for fn, branches := range expansions {
+		fn.Branches = append(fn.Branches, branches...)
+	}
+	return nil
+}
+
+// inlined returns a BranchCall for each helper fn calls that has branches
+// leading to a return, holding those branches and, depth permitting, the
+// helper's own helpers. seen stops recursion from expanding forever.
+func inlined(fn *FuncInfo, funcs map[string]*FuncInfo, depth int, seen map[string]bool) []*Branch {
+	if depth == 0 {
+		return nil
+	}
+	var calls []*Branch
+	for _, key := range sortedKeys(fn.LocalCalls) {
+		callee, ok := funcs[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		children := append(returnsOnly(callee.Branches), inlined(callee, funcs, depth-1, seen)...)
+		delete(seen, key)
+		if len(children) == 0 {
+			continue
+		}
+		anyBranch(children, func(b *Branch) bool {
+			b.Wraps = nil   // the helper's file may import what this one does not
+			b.Returns = nil // the helper's results, not those of fn
+			return false
+		})
+		calls = append(calls, &Branch{
+			Type:      BranchCall,
+			Line:      callee.Line,
+			CodeLine:  "via " + key,
+			Children:  children,
+			hasReturn: true,
+		})
+	}
+	return calls
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// branchCondition returns the condition b is taken on, and whether b takes
+// it false, as the else of an if does; ok is false for branches other than
+// an if, an else if or an else.
+func branchCondition(b *Branch) (cond ast.Expr, negate, ok bool) {
+	code := strings.Join(strings.Fields(b.CodeLine), " ")
+	if inner, found := strings.CutPrefix(code, "else // of ["); found {
+		code, negate = inner[:strings.LastIndex(inner, "]")], true
+	}
+	if i := strings.Index(code, " //"); i >= 0 {
+		code = code[:i]
+	}
+	code, found := strings.CutPrefix(strings.TrimPrefix(code, "else "), "if ")
+	if !found {
+		return nil, false, false
+	}
+	if i := strings.LastIndex(code, "; "); i >= 0 {
+		code = code[i+2:]
+	}
+	expr, err := parser.ParseExpr(strings.TrimSuffix(code, " {"))
+	if err != nil {
+		return nil, false, false
+	}
+	return expr, negate, true
+}
+
+// suggestInputs proposes parameter values taking the branch b, for the
+// simple conditions comparing a parameter with a constant, such as n > 0
+// suggesting n = 1, or none. operands are the other names the constant may
+// be, as FuncInfo.Operands.
+func suggestInputs(b *Branch, params, operands map[string]bool) []string {
+	cond, negate, ok := branchCondition(b)
+	if !ok {
+		return nil
+	}
+	return conditionInputs(cond, params, operands, negate)
+}
+
+// boundaryInputs proposes the parameter values on either side of the
+// condition of b, those taking it and those skipping it, such as 101 and
+// 100 for n > 100, or "" and "x" for s == "".
+func boundaryInputs(b *Branch, params, operands map[string]bool) (take, skip []string) {
+	cond, negate, ok := branchCondition(b)
+	if !ok {
+		return nil, nil
+	}
+	return conditionInputs(cond, params, operands, negate), conditionInputs(cond, params, operands, !negate)
+}
+
+// conditionInputs proposes values for the parameters compared in cond, made
+// true, or false when negate is set.
+func conditionInputs(cond ast.Expr, params, operands map[string]bool, negate bool) []string {
+	switch e := cond.(type) {
+	case *ast.ParenExpr:
+		return conditionInputs(e.X, params, operands, negate)
+	case *ast.Ident:
+		if params[e.Name] {
+			return []string{e.Name + " = " + strconv.FormatBool(!negate)}
+		}
+	case *ast.UnaryExpr:
+		if e.Op == token.NOT {
+			return conditionInputs(e.X, params, operands, !negate)
+		}
+	case *ast.BinaryExpr:
+		// a && b holds with both, and fails with either; keep it to the first
+		if e.Op == token.LAND && !negate || e.Op == token.LOR && negate {
+			return append(conditionInputs(e.X, params, operands, negate), conditionInputs(e.Y, params, operands, negate)...)
+		}
+		if e.Op == token.LAND || e.Op == token.LOR {
+			return conditionInputs(e.X, params, operands, negate)
+		}
+		return comparisonInputs(e, params, operands, negate)
+	}
+	return nil
+}
+
+// negated maps each comparison to its opposite.
+var negated = map[token.Token]token.Token{
+	token.EQL: token.NEQ, token.NEQ: token.EQL,
+	token.LSS: token.GEQ, token.GEQ: token.LSS,
+	token.GTR: token.LEQ, token.LEQ: token.GTR,
+}
+
+// mirrored maps each comparison to the one holding with its operands swapped.
+var mirrored = map[token.Token]token.Token{
+	token.EQL: token.EQL, token.NEQ: token.NEQ,
+	token.LSS: token.GTR, token.GTR: token.LSS,
+	token.LEQ: token.GEQ, token.GEQ: token.LEQ,
+}
+
+// comparisonInputs proposes a value for a parameter, or its length, compared
+// with a constant or another parameter: the value just past the boundary
+// for an ordering, and for != one that differs. A local or a field the test
+// cannot name is no boundary.
+func comparisonInputs(e *ast.BinaryExpr, params, operands map[string]bool, negate bool) []string {
+	op, ok := e.Op, negated[e.Op] != 0
+	if !ok {
+		return nil
+	}
+	if negate {
+		op = negated[op]
+	}
+	name, value := comparedParam(e.X, params), e.Y
+	if name == "" {
+		// the constant first, as in 0 < n
+		name, value, op = comparedParam(e.Y, params), e.X, mirrored[op]
+	}
+	if name == "" {
+		return nil
+	}
+
+	lit, symbolic := "", false
+	switch v := value.(type) {
+	case *ast.BasicLit:
+		lit = v.Value
+	case *ast.Ident:
+		lit = v.Name
+		symbolic = lit != "nil" && lit != "true" && lit != "false"
+		if symbolic && !params[lit] && !operands[lit] {
+			return nil
+		}
+	case *ast.SelectorExpr:
+		if x, ok := v.X.(*ast.Ident); ok && operands[x.Name] && !params[x.Name] {
+			lit, symbolic = types.ExprString(v), true
+		}
+	case *ast.UnaryExpr:
+		if x, ok := v.X.(*ast.BasicLit); ok && v.Op == token.SUB {
+			lit = "-" + x.Value
+		}
+	}
+	if lit == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(lit)
+	isInt := err == nil
+	switch {
+	case op == token.EQL, op == token.GEQ, op == token.LEQ:
+		return []string{name + " = " + lit}
+	case op == token.NEQ:
+		switch {
+		case isInt:
+			return []string{name + " = " + strconv.Itoa(n+1)}
+		case lit == `""`:
+			return []string{name + ` = "x"`}
+		case strings.HasPrefix(lit, `"`):
+			return []string{name + ` = ""`}
+		case lit == "true":
+			return []string{name + " = false"}
+		case lit == "false":
+			return []string{name + " = true"}
+		}
+	case op == token.GTR && isInt:
+		return []string{name + " = " + strconv.Itoa(n+1)}
+	case op == token.LSS && isInt:
+		return []string{name + " = " + strconv.Itoa(n-1)}
+	case op == token.GTR && symbolic:
+		return []string{name + " = " + lit + " + 1"}
+	case op == token.LSS && symbolic:
+		return []string{name + " = " + lit + " - 1"}
+	}
+	return []string{name + " " + op.String() + " " + lit}
+}
+
+// comparedParam returns the parameter, or length of one, that x stands for,
+// or "".
+func comparedParam(x ast.Expr, params map[string]bool) string {
+	switch x := x.(type) {
+	case *ast.Ident:
+		if params[x.Name] {
+			return x.Name
+		}
+	case *ast.CallExpr:
+		if fn, ok := x.Fun.(*ast.Ident); ok && fn.Name == "len" && len(x.Args) == 1 {
+			if arg, ok := x.Args[0].(*ast.Ident); ok && params[arg.Name] {
+				return "len(" + arg.Name + ")"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// manifestFile records, under the baseDir of the directory a batch run was
+// given, how far an interrupted run got, for -resume to go on from there.
+const manifestFile = "manifest.json"
+
+// exitInterrupted is the exit code of a batch run stopped by SIGINT, as
+// shells report a process killed by it.
+const exitInterrupted = 130
+
+// manifest is the progress of an interrupted batch run.
+type manifest struct {
+	Source    string   `json:"source"`           // -src of the run
+	Completed []string `json:"completed"`        // files whose tests are written
+	Failed    []string `json:"failed,omitempty"` // files that failed, tried again on -resume
+	Pending   []string `json:"pending"`          // files not yet reached
+}
+
+// manifestPath returns where the manifest of a batch run over src is kept.
+func manifestPath(src string) string {
+	return filepath.Join(strings.TrimSuffix(src, "/..."), baseDir, manifestFile)
+}
+
+// readManifest returns the manifest an interrupted run over src left, or nil
+// when there is none.
+func readManifest(src string) (*manifest, error) {
+	data, err := os.ReadFile(manifestPath(src))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath(src), err)
+	}
+	return &m, nil
+}
+
+// writeManifest records m for the run over src.
+func writeManifest(src string, m *manifest) error {
+	path := manifestPath(src)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// removeManifest drops the manifest of a run over src once one finishes.
+func removeManifest(src string) error {
+	err := os.Remove(manifestPath(src))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// watchInterrupt catches the first SIGINT, for a batch run to stop between
+// files rather than halfway through writing one; a second one kills the
+// process as usual. It returns whether one came, and a func to stop watching.
+func watchInterrupt() (interrupted func() bool, stop func()) {
+	var caught atomic.Bool
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		if _, ok := <-signals; ok {
+			caught.Store(true)
+			signal.Stop(signals)
+			fmt.Fprintln(os.Stderr, "\ninterrupted: finishing the current file, interrupt again to quit now")
+		}
+	}()
+	return caught.Load, func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+// interruptError reports a batch run stopped by SIGINT, with the manifest
+// it left.
+type interruptError struct {
+	manifest  string
+	completed int
+	pending   int
+}
+
+func (e *interruptError) Error() string {
+	return fmt.Sprintf("interrupted with %d files done and %d to go, recorded in %s; run again with -resume to finish",
+		e.completed, e.pending, e.manifest)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+)
+
+// yieldTypes returns the types an iterator yields, for the function type of
+// a range-over-func iterator, func(yield func(K[, V]) bool), or nil for any
+// other type.
+func yieldTypes(typ *ast.FuncType) []ast.Expr {
+	if typ.Results != nil && len(typ.Results.List) > 0 || typ.Params == nil || typ.Params.NumFields() != 1 {
+		return nil
+	}
+	yield, ok := typ.Params.List[0].Type.(*ast.FuncType)
+	if !ok || yield.Results == nil || yield.Results.NumFields() != 1 {
+		return nil
+	}
+	if res, ok := yield.Results.List[0].Type.(*ast.Ident); !ok || res.Name != "bool" {
+		return nil
+	}
+	var yielded []ast.Expr
+	for _, field := range yield.Params.List {
+		n := max(len(field.Names), 1)
+		for range n {
+			yielded = append(yielded, field.Type)
+		}
+	}
+	if len(yielded) == 0 || len(yielded) > 2 {
+		return nil
+	}
+	return yielded
+}
+
+// iterTypes returns the types spelled in the source an iterator type typ
+// yields: iter.Seq[V], iter.Seq2[K, V] or the function type they stand for.
+// It is nil for other types.
+func iterTypes(typ string) []string {
+	expr, err := parser.ParseExpr(typ)
+	if err != nil {
+		return nil
+	}
+	var yielded []ast.Expr
+	switch e := expr.(type) {
+	case *ast.FuncType:
+		yielded = yieldTypes(e)
+	case *ast.IndexExpr:
+		if types.ExprString(e.X) == "iter.Seq" {
+			yielded = []ast.Expr{e.Index}
+		}
+	case *ast.IndexListExpr:
+		if types.ExprString(e.X) == "iter.Seq2" && len(e.Indices) == 2 {
+			yielded = e.Indices
+		}
+	}
+	names := make([]string, len(yielded))
+	for i, y := range yielded {
+		names[i] = types.ExprString(y)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return names
+}
+
+// isIter reports whether typ is an iterator type.
+func isIter(typ string) bool {
+	return iterTypes(typ) != nil
+}
+
+// iteratorBody returns the statements of fn to extract branches from. For a
+// function returning an iterator literal, they are those of the literal,
+// whose loop is what runs when the caller ranges over the result, after
+// what precedes the return. The iterator may come with other results, as
+// in `return func(yield func(T) bool) { ... }, nil`.
+func iteratorBody(fn *ast.FuncDecl) *ast.BlockStmt {
+	if fn.Body == nil || len(fn.Body.List) == 0 {
+		return fn.Body
+	}
+	last := len(fn.Body.List) - 1
+	ret, ok := fn.Body.List[last].(*ast.ReturnStmt)
+	if !ok {
+		return fn.Body
+	}
+	var lit *ast.FuncLit
+	for _, result := range ret.Results {
+		if l, ok := result.(*ast.FuncLit); ok && yieldTypes(l.Type) != nil {
+			if lit != nil {
+				return fn.Body // which of the iterators runs is the caller's choice
+			}
+			lit = l
+		}
+	}
+	if lit == nil {
+		return fn.Body
+	}
+	list := append(fn.Body.List[:last:last], lit.Body.List...)
+	return &ast.BlockStmt{Lbrace: fn.Body.Lbrace, List: list, Rbrace: fn.Body.Rbrace}
+}
+
+// IterSeq is an iterator a test of a function under test ranges over: one it
+// returns, or the function itself when it is one.
+type IterSeq struct {
+	Name  string // local variable holding the iterator
+	Type  string // its type
+	Items string // local variable collecting what it yields
+	Key   string // type yielded, or the first of a two-value iterator
+	Elem  string // second type of a two-value iterator, "" for others
+}
+
+// IsIter reports whether fn is itself an iterator, taking only a yield
+// function, so that its method value can be ranged over.
+func (fn FuncInfo) IsIter() bool {
+	return len(fn.Results) == 0 && len(fn.Params) == 1 && isIter("func(yield "+fn.Params[0].Type+")")
+}
+
+// IterSeqs returns the iterators a test of fn ranges over.
+func (fn FuncInfo) IterSeqs() []IterSeq {
+	seq := func(name, typ, items string) IterSeq {
+		yielded := iterTypes(typ)
+		s := IterSeq{Name: name, Type: typ, Items: items, Key: yielded[0]}
+		if len(yielded) == 2 {
+			s.Elem = yielded[1]
+		}
+		return s
+	}
+	if fn.IsIter() {
+		return []IterSeq{seq("seq", "func(yield "+fn.Params[0].Type+")", "items")}
+	}
+	var seqs []IterSeq
+	got := fn.GotNames()
+	for i, r := range fn.Results {
+		if isIter(r.Type) {
+			seqs = append(seqs, seq(got[i], r.Type, "items"+strings.TrimPrefix(got[i], "got")))
+		}
+	}
+	return seqs
+}
+
+// ReturnsIter reports whether fn returns an iterator.
+func (fn FuncInfo) ReturnsIter() bool {
+	for _, r := range fn.Results {
+		if isIter(r.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIters reports whether a test of fn ranges over iterators.
+func (fn FuncInfo) HasIters() bool {
+	return fn.IsIter() || fn.ReturnsIter()
+}
+
+// IterCall renders the statement getting the iterators of fn: its method
+// value when it is one, or else a call with zero arguments assigning only
+// its iterator results.
+func (fn FuncInfo) IterCall() string {
+	if fn.IsIter() {
+		return "seq := " + fn.Callee()
+	}
+	lhs := fn.GotNames()
+	for i, r := range fn.Results {
+		if !isIter(r.Type) {
+			lhs[i] = "_"
+		}
+	}
+	return strings.Join(lhs, ", ") + " = " + fn.Callee() + "(" + zeroArgs(fn.Params, 0) + ")"
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONField is a field of a struct with a json tag, as the round-trip test
+// of the struct sets and decodes it.
+type JSONField struct {
+	Name      string // the Go field
+	Key       string // its name in JSON
+	OmitEmpty bool   // tagged omitempty, on a type it leaves out of the JSON when zero
+	Value     string // a representative value as a Go literal, "" for types left zero
+	JSON      string // the value as JSON text
+}
+
+// jsonFields returns the json-tagged fields of a struct, or nil when none
+// is tagged. Fields tagged "-", embedded and unexported ones, which
+// encoding/json ignores, are left out; those of types without an obvious
+// representative value are kept, left zero. local maps the types the file
+// declares to their definitions.
+func jsonFields(fields []Field, local map[string]ast.Expr) []JSONField {
+	var tagged []JSONField
+	for _, f := range fields {
+		tag, ok := reflect.StructTag(f.Tag).Lookup("json")
+		if !ok || tag == "-" || f.Name == "" || !ast.IsExported(f.Name) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		jf := JSONField{Name: f.Name, Key: name}
+		if jf.Key == "" {
+			jf.Key = f.Name
+		}
+		quoted := false
+		for _, opt := range strings.Split(opts, ",") {
+			jf.OmitEmpty = jf.OmitEmpty || opt == "omitempty"
+			quoted = quoted || opt == "string"
+		}
+		jf.OmitEmpty = jf.OmitEmpty && omitsZero(f.Type, local, 0)
+		jf.Value, jf.JSON = representative(f.Type, jf.Key)
+		if quoted && jf.Value != "" && !strings.HasPrefix(jf.JSON, `"`) {
+			jf.JSON = strconv.Quote(jf.JSON)
+		}
+		tagged = append(tagged, jf)
+	}
+	return tagged
+}
+
+// omitsZero reports whether omitempty leaves a zero field of type typ out
+// of the JSON: it does for basic types, pointers, slices, maps and
+// interfaces, and for local types defined as one of them, but not for
+// structs or arrays, nor for types of other packages, which are structs
+// more often than not.
+func omitsZero(typ string, local map[string]ast.Expr, depth int) bool {
+	if def, ok := local[typ]; ok {
+		if _, isStruct := def.(*ast.StructType); isStruct || depth > 8 {
+			return false
+		}
+		return omitsZero(types.ExprString(def), local, depth+1)
+	}
+	if _, ok := basicTypes[typ]; ok {
+		return true
+	}
+	for _, prefix := range []string{"*", "[]", "map[", "interface{", "func(", "chan ", "<-chan"} {
+		if strings.HasPrefix(typ, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// basicTypes are the predeclared types omitempty leaves out when zero.
+var basicTypes = map[string]bool{
+	"any": true, "error": true, "string": true, "bool": true, "byte": true, "rune": true, "uintptr": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// localTypes maps the types node declares to their definitions.
+func localTypes(node *ast.File) map[string]ast.Expr {
+	local := make(map[string]ast.Expr)
+	for _, decl := range node.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams == nil {
+					local[ts.Name.Name] = ts.Type
+				}
+			}
+		}
+	}
+	return local
+}
+
+// representative returns a value other than the zero one for a field of a
+// basic type, as a Go literal and as JSON, or "" for other types. A string
+// is set to the field's key, so a value decoded into the wrong field shows.
+func representative(typ, key string) (goValue, jsonValue string) {
+	switch typ {
+	case "string":
+		return strconv.Quote(key), strconv.Quote(key)
+	case "bool":
+		return "true", "true"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "1", "1"
+	case "float32", "float64":
+		return "1.5", "1.5"
+	}
+	return "", ""
+}
+
+// HasJSON reports whether the struct has json tags, for its suite to test
+// that it survives a round trip through encoding/json.
+func (si *StructInfo) HasJSON() bool {
+	return len(si.JSON) > 0
+}
+
+// JSONLiteral is a JSON object with the representative values of the
+// struct's fields, as its tags name them.
+func (si *StructInfo) JSONLiteral() string {
+	var pairs []string
+	for _, f := range si.JSON {
+		if f.Value != "" {
+			pairs = append(pairs, strconv.Quote(f.Key)+": "+f.JSON)
+		}
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -2,31 +2,100 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 var (
-	srcFile = flag.String("src", "", "source go file to analyze")
-	scope   = flag.String("scope", "struct", "test scope: 'func', 'struct', or 'all'")
-	paths   = flag.String("paths", "all", "path filtering: 'all' or 'return'")
-	noctor  = flag.Bool("noctor", true, "no construct for type, use with -scope=struct")
+	srcFile   = flag.String("src", "", "source go file to analyze, or a directory, or a tree when it ends in /...")
+	pos       = flag.String("pos", "", "generate only the function around file.go:line or file.go:#offset, updating its test in place")
+	scope     = flag.String("scope", "struct", "test scope: 'func', 'struct', 'interface', or 'all'")
+	paths     = flag.String("paths", "all", "path filtering: 'all' or 'return'")
+	noctor    = flag.Bool("noctor", true, "no construct for type, use with -scope=struct")
+	style     = flag.String("style", "default", "assertion style: 'default', 'snapshot', or 'cmp' for go-cmp diffs")
+	logger    = flag.String("logger", "auto", "test logger idiom: 'auto', 'slog', 'logrus' or 'zap'")
+	clock     = flag.Bool("fakeclock", false, "add a fake clock to suites whose methods call time.Now")
+	inline    = flag.Int("inline-depth", 0, "merge the return paths of same-package functions called up to this many calls deep")
+	flatten   = flag.Bool("flatten", false, "generate one flat case per path from the top of a function down to a leaf, instead of nesting cases as the branches nest")
+	maxDepth  = flag.Int("max-depth", 0, "collapse branches nested deeper than this into one case at that depth, 0 for no limit")
+	minBr     = flag.Int("min-branches", 0, "skip functions with fewer branches than this")
+	getters   = flag.Bool("include-accessors", false, "keep trivial getters and setters")
+	wrappers  = flag.Bool("include-wrappers", false, "keep functions whose body only forwards to another function or method")
+	wellKn    = flag.Bool("include-wellknown", false, "keep String, Error, MarshalJSON and similar canonical methods")
+	tmplDir   = flag.String("templates", "", "directory with custom suite/func/contract/branch/setup/fixtures/runner/tags/init .tmpl files")
+	header    = flag.String("header", "", "file whose contents, such as a license header, start every generated file")
+	marker    = flag.Bool("marker", true, "stamp generated files DO NOT EDIT; turn off for files meant to be edited by hand")
+	prune     = flag.Bool("prune", false, "remove suites generated for types the source no longer declares, instead of reporting them")
+	output    = flag.String("output", "files", "where generated files go: 'files', or 'stdout' or 'tar' to stream them instead of writing the repository")
+	fixture   = flag.Bool("fixtures", false, "share helpers such as the fake clock and exec runner through one "+fixturesFile+" per package")
+	runner    = flag.Bool("runner", false, "run every generated suite from one "+runnerFile+", so go test -run TestSuites runs them all")
+	tagCheck  = flag.Bool("struct-tags", false, "check the json/yaml/db/validate tags of the package's structs against the tags policy of "+configFile+" in one "+tagsFile)
+	logFormat = flag.String("log-format", "text", "activity log format: 'text', or 'json' for one machine-readable event per line")
+	merge     = flag.Bool("merge", false, "three-way merge regenerated files with hand edits, keeping the last generation in .twintest/; implies -marker=false")
+	dataFiles = flag.String("data-files", "", "keep the table cases of functions taking data in 'json' or 'yaml' files under testdata/, read by a generated loader")
+	baseSuite = flag.String("base-suite", "BaseSuite", "suite type which, when the test package declares it, generated suites embed instead of suite.Suite")
+	shard     = flag.Int("shard", 0, "split suites of more test methods than this into files of at most this many, grouped by method name prefix")
+	precise   = flag.Bool("precise", false, "prune branches whose conditions contradict those holding on the way to them, such as n < -10 after returning on n < 0")
+	resume    = flag.Bool("resume", false, "with a directory -src, skip the files an interrupted run over it completed, as its manifest in "+baseDir+"/ records")
+	deadline  = flag.Duration("deadline", 5*time.Second, "how long generated channel and concurrency tests wait before failing, cut short by go test -timeout")
 )
 
 func main() {
-	flag.Parse()
+	subcommands := map[string]func([]string) error{
+		"clean": runClean,
+		"gate":  runGate,
+		"names": runNames,
+		"plan":  runPlan,
+		"rank":  runRank,
+		"trace": runTrace,
+	}
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		if err := subcommands[os.Args[1]](os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	serving := len(os.Args) > 1 && os.Args[1] == "serve"
+	if serving {
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
-	if *srcFile == "" {
-		fmt.Fprintln(os.Stderr, "error: -src is required")
+	line := 0
+	if *pos != "" {
+		var err error
+		if *srcFile, line, err = parsePos(*pos); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if resolved, err := resolveSrc(*srcFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	} else {
+		*srcFile = resolved
+	}
+
+	if *srcFile == "" && !serving {
+		fmt.Fprintln(os.Stderr, "error: -src or -pos is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	validScope := map[string]bool{"func": true, "struct": true, "all": true}
+	validScope := map[string]bool{"func": true, "struct": true, "interface": true, "all": true}
 	if !validScope[*scope] {
-		fmt.Fprintf(os.Stderr, "error: -scope must be one of 'func', 'struct', 'all'\n")
+		fmt.Fprintf(os.Stderr, "error: -scope must be one of 'func', 'struct', 'interface', 'all'\n")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -38,30 +107,184 @@ func main() {
 		os.Exit(1)
 	}
 
-	structInfo, packageName, err := ParseFile(*srcFile)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+	validStyle := map[string]bool{"default": true, "snapshot": true, "cmp": true}
+	if *dataFiles != "" && *dataFiles != "json" && *dataFiles != "yaml" {
+		fmt.Fprintf(os.Stderr, "error: -data-files must be 'json' or 'yaml'\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *maxDepth < 0 {
+		fmt.Fprintf(os.Stderr, "error: -max-depth must not be negative\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *deadline <= 0 {
+		fmt.Fprintf(os.Stderr, "error: -deadline must be positive\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !validStyle[*style] {
+		fmt.Fprintf(os.Stderr, "error: -style must be 'default', 'snapshot' or 'cmp'\n")
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	if len(structInfo) == 0 {
-		fmt.Println("No testable functions/methods found.")
+	validLogger := map[string]bool{"auto": true, "slog": true, "logrus": true, "zap": true}
+	if !validLogger[*logger] {
+		fmt.Fprintf(os.Stderr, "error: -logger must be one of 'auto', 'slog', 'logrus', 'zap'\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	validLogFormat := map[string]bool{"text": true, "json": true}
+	if !validLogFormat[*logFormat] {
+		fmt.Fprintf(os.Stderr, "error: -log-format must be 'text' or 'json'\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	validOutput := map[string]bool{"files": true, "stdout": true, "tar": true}
+	if !validOutput[*output] {
+		fmt.Fprintf(os.Stderr, "error: -output must be one of 'files', 'stdout', 'tar'\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *output != "files" {
+		if serving {
+			fmt.Fprintf(os.Stderr, "error: serve needs -output=files\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		if *merge {
+			fmt.Fprintf(os.Stderr, "error: -merge needs -output=files\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		status = os.Stderr
+	}
+
+	if serving {
+		status = os.Stderr
+		if err := serve(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 		return
 	}
 
-	structInfo = trimByScope(structInfo)
-	structInfo = trimByPaths(structInfo)
-	if *noctor {
-		structInfo = trimConstructor(structInfo)
+	var err error
+	if line == 0 && isBatch(*srcFile) {
+		err = runBatch(*srcFile)
+	} else {
+		_, err = run(*srcFile, line)
+	}
+	if cerr := closeStream(); err == nil {
+		err = cerr
+	}
+	var stopped *interruptError
+	if errors.As(err, &stopped) {
+		logEvent(os.Stderr, eventInterrupted, stopped.Error(),
+			"manifest", stopped.manifest, "completed", stopped.completed, "pending", stopped.pending)
+		os.Exit(exitInterrupted)
+	}
+	var failed *batchError
+	if errors.As(err, &failed) {
+		if *logFormat == "json" {
+			logEvent(os.Stderr, eventError, fmt.Sprintf("%d of %d files failed", len(failed.failures), failed.files),
+				"failed", len(failed.failures), "files", failed.files)
+		} else {
+			fmt.Fprintln(os.Stderr, failed)
+		}
+		os.Exit(failed.exitCode())
+	}
+	if err != nil {
+		logFailure(*srcFile, err)
+		os.Exit(exitFailure)
+	}
+	logEvent(status, eventDone, "Done "+*srcFile, "source", *srcFile)
+}
+
+// run generates the tests for src as the flags direct, and returns the paths
+// of the generated files. A non-zero line limits it to the function there.
+func run(src string, line int) ([]string, error) {
+	var err error
+	if config, err = loadConfig(filepath.Dir(src)); err != nil {
+		return nil, err
 	}
-	structInfo = trimNoMethod(structInfo)
 
-	err = GenerateTestFiles(*srcFile, structInfo, packageName)
+	structInfo, packageName, err := ParseFile(src)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return nil, err
 	}
-	fmt.Printf("Done %s\n", *srcFile)
+	logEvent(status, eventAnalyzed, "", "source", src, "types", len(structInfo))
+	return generateParsed(src, line, structInfo, packageName)
+}
+
+// generateParsed is run from the types parsed out of src, which it trims and
+// annotates in place.
+func generateParsed(src string, line int, structInfo []*StructInfo, packageName string) ([]string, error) {
+	var err error
+	if err := pruneOrphans(src, structInfo); err != nil {
+		return nil, err
+	}
+
+	if len(structInfo) == 0 {
+		logEvent(status, eventSkipped, "No testable functions/methods found.", "source", src)
+		return nil, nil
+	}
+
+	trimDead(structInfo, src)
+	if *inline > 0 {
+		if err := inlineCalls(structInfo, src, packageName, *inline); err != nil {
+			return nil, err
+		}
+	}
+
+	// before trimming drops the structs whose fields cmp options look into
+	switch *style {
+	case "snapshot":
+		markSnapshot(structInfo)
+	case "cmp":
+		markCompare(structInfo)
+	}
+	markDataFiles(structInfo)
+	restrictBlackBox(structInfo)
+	chooseConstructors(structInfo)
+	markParallel(structInfo)
+	if line > 0 {
+		// the function was asked for by position, whatever the filters say
+		if structInfo, err = trimToLine(structInfo, line); err != nil {
+			return nil, err
+		}
+		structInfo = trimByPaths(structInfo)
+		structInfo = trimByDepth(structInfo)
+	} else {
+		structInfo = trimByScope(structInfo)
+		structInfo = trimByPaths(structInfo)
+		structInfo = trimByDepth(structInfo)
+		structInfo = trimByMinBranches(structInfo)
+		if !*getters {
+			structInfo = trimAccessors(structInfo)
+		}
+		if !*wrappers {
+			structInfo = trimWrappers(structInfo)
+		}
+		if !*wellKn {
+			structInfo = trimWellKnown(structInfo)
+		}
+		if *noctor {
+			structInfo = trimConstructor(structInfo)
+		}
+	}
+	structInfo = trimNoMethod(structInfo)
+	injectLogger(structInfo)
+	if *clock {
+		injectClock(structInfo)
+	}
+
+	sortByPosition(structInfo)
+
+	return GenerateTestFiles(src, structInfo, packageName)
 }
 
 func trimByScope(structInfo []*StructInfo) []*StructInfo {
@@ -76,7 +299,15 @@ func trimByScope(structInfo []*StructInfo) []*StructInfo {
 	case "struct":
 		newStructInfo := structInfo[:0]
 		for i := range structInfo {
-			if structInfo[i].Name != "" {
+			if structInfo[i].Name != "" && !structInfo[i].IsInterface {
+				newStructInfo = append(newStructInfo, structInfo[i])
+			}
+		}
+		structInfo = newStructInfo
+	case "interface":
+		newStructInfo := structInfo[:0]
+		for i := range structInfo {
+			if structInfo[i].IsInterface {
 				newStructInfo = append(newStructInfo, structInfo[i])
 			}
 		}
@@ -107,6 +338,35 @@ func trimByPaths(structInfo []*StructInfo) []*StructInfo {
 	return structInfo
 }
 
+// trimByDepth collapses the branches nested deeper than -max-depth into
+// their ancestor at that depth, which becomes a single case noting how many
+// paths it stands for.
+func trimByDepth(structInfo []*StructInfo) []*StructInfo {
+	if *maxDepth == 0 {
+		return structInfo
+	}
+	var collapse func(branches []*Branch, depth int)
+	collapse = func(branches []*Branch, depth int) {
+		for _, b := range branches {
+			if depth < *maxDepth {
+				collapse(b.Children, depth+1)
+				continue
+			}
+			if len(b.Children) > 0 {
+				b.hasReturn = b.HasReturn()
+				b.Collapsed = len(leafPaths(b.Children))
+				b.Children = nil
+			}
+		}
+	}
+	for _, si := range structInfo {
+		for i := range si.Methods {
+			collapse(si.Methods[i].Branches, 1)
+		}
+	}
+	return structInfo
+}
+
 func trimNoReturnBranch(branch *Branch) {
 	newBranch := branch.Children[:0]
 	for i := range branch.Children {
@@ -119,10 +379,112 @@ func trimNoReturnBranch(branch *Branch) {
 	branch.Children = newBranch
 }
 
+func trimByMinBranches(structInfo []*StructInfo) []*StructInfo {
+	if *minBr <= 0 {
+		return structInfo
+	}
+
+	for i := range structInfo {
+		if structInfo[i].IsInterface {
+			continue // contract methods have no body to branch in
+		}
+		newMethods := structInfo[i].Methods[:0]
+		for _, method := range structInfo[i].Methods {
+			if countBranches(method.Branches) >= *minBr {
+				newMethods = append(newMethods, method)
+			}
+		}
+		structInfo[i].Methods = newMethods
+	}
+
+	return structInfo
+}
+
+func trimAccessors(structInfo []*StructInfo) []*StructInfo {
+	for i := range structInfo {
+		newMethods := structInfo[i].Methods[:0]
+		for _, method := range structInfo[i].Methods {
+			if !method.IsAccessor {
+				newMethods = append(newMethods, method)
+			}
+		}
+		structInfo[i].Methods = newMethods
+	}
+
+	return structInfo
+}
+
+func trimWrappers(structInfo []*StructInfo) []*StructInfo {
+	for i := range structInfo {
+		newMethods := structInfo[i].Methods[:0]
+		for _, method := range structInfo[i].Methods {
+			if !method.IsWrapper {
+				newMethods = append(newMethods, method)
+			}
+		}
+		structInfo[i].Methods = newMethods
+	}
+
+	return structInfo
+}
+
+// wellKnownMethods maps canonical interface methods to their parameter
+// counts; they implement a standard contract rather than carry branches.
+var wellKnownMethods = map[string]int{
+	"String":          0,
+	"GoString":        0,
+	"Error":           0,
+	"Format":          2,
+	"MarshalJSON":     0,
+	"UnmarshalJSON":   1,
+	"MarshalText":     0,
+	"UnmarshalText":   1,
+	"MarshalBinary":   0,
+	"UnmarshalBinary": 1,
+	"MarshalYAML":     0,
+	"UnmarshalYAML":   1,
+	"Scan":            1,
+	"Value":           0,
+	"Len":             0,
+	"Less":            2,
+	"Swap":            2,
+}
+
+func trimWellKnown(structInfo []*StructInfo) []*StructInfo {
+	for i := range structInfo {
+		if structInfo[i].Name == "" {
+			continue
+		}
+		newMethods := structInfo[i].Methods[:0]
+		for _, method := range structInfo[i].Methods {
+			if n, ok := wellKnownMethods[method.Name]; ok && n == len(method.Params) {
+				continue
+			}
+			newMethods = append(newMethods, method)
+		}
+		structInfo[i].Methods = newMethods
+	}
+
+	return structInfo
+}
+
+// sortByPosition orders structs and their methods by where they are declared,
+// package functions first, so repeated runs generate identical files.
+func sortByPosition(structInfo []*StructInfo) {
+	sort.SliceStable(structInfo, func(i, j int) bool {
+		return structInfo[i].Line < structInfo[j].Line
+	})
+	for _, si := range structInfo {
+		sort.SliceStable(si.Methods, func(i, j int) bool {
+			return si.Methods[i].Line < si.Methods[j].Line
+		})
+	}
+}
+
 func trimNoMethod(structInfo []*StructInfo) []*StructInfo {
 	newStructInfo := structInfo[:0]
 	for i := range structInfo {
-		if len(structInfo[i].Methods) == 0 {
+		if len(structInfo[i].Methods) == 0 && structInfo[i].Templates == nil && structInfo[i].Init == nil && !structInfo[i].HasJSON() {
 			continue
 		}
 		newStructInfo = append(newStructInfo, structInfo[i])
@@ -130,6 +492,8 @@ func trimNoMethod(structInfo []*StructInfo) []*StructInfo {
 	return newStructInfo
 }
 
+// trimConstructor drops the constructors from the package functions; those
+// of a suite it does not set up with are tested in the suite instead.
 func trimConstructor(structInfo []*StructInfo) []*StructInfo {
 	m := make(map[string]bool, len(structInfo))
 	var funcInfo *StructInfo
@@ -137,6 +501,10 @@ func trimConstructor(structInfo []*StructInfo) []*StructInfo {
 		if name := structInfo[i].Name; name != "" {
 			m["New"+name] = true
 			m["new"+name] = true
+			for _, fn := range structInfo[i].Constructors {
+				m[fn.Name] = true
+			}
+			structInfo[i].CtorStubs = true
 		} else {
 			funcInfo = structInfo[i]
 		}
@@ -157,3 +525,83 @@ func trimConstructor(structInfo []*StructInfo) []*StructInfo {
 
 	return structInfo
 }
+
+// markSnapshot flags methods whose results are worth snapshotting: complex
+// values (structs, pointers, slices, maps) or strings.
+func markSnapshot(structInfo []*StructInfo) {
+	for i := range structInfo {
+		for ii := range structInfo[i].Methods {
+			method := &structInfo[i].Methods[ii]
+			for _, result := range method.Results {
+				if isSnapshotType(result.Type) {
+					method.Snapshot = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// markCompare picks the result each method diffs with go-cmp: the first
+// that is not an error, spelled as any where type parameters of the
+// function itself would be out of scope, and the options it needs.
+func markCompare(structInfo []*StructInfo) {
+	structs := make(map[string]*StructInfo)
+	for _, si := range structInfo {
+		if si.Name != "" && !si.IsInterface {
+			structs[si.Name] = si
+		}
+	}
+	for _, si := range structInfo {
+		for i := range si.Methods {
+			method := &si.Methods[i]
+			for _, result := range method.Results {
+				if isErrorType(result.Type) || isRecvChan(result.Type) || isFuncType(result.Type) {
+					continue
+				}
+				method.Compare = result.Type
+				if method.Generic {
+					method.Compare = "any"
+				}
+				method.CmpOpts = cmpOptions(result.Type, structs, si.fileImports)
+				break
+			}
+		}
+	}
+}
+
+func isSnapshotType(typ string) bool {
+	switch typ {
+	case "string":
+		return true
+	case "error", "bool", "byte", "rune", "uintptr",
+		"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64",
+		"float32", "float64", "complex64", "complex128":
+		return false
+	}
+	return !strings.HasPrefix(typ, "chan ") && !strings.HasPrefix(typ, "<-chan") &&
+		!strings.HasPrefix(typ, "func")
+}
+
+// injectLogger settles the logging idiom of suites that log, honoring
+// -logger over the detected library.
+func injectLogger(structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if si.Logger == "" || si.Name == "" {
+			continue
+		}
+		if *logger != "auto" {
+			si.Logger = *logger
+		}
+	}
+}
+
+// injectClock gives suites whose methods read the wall clock a fixed fake clock.
+func injectClock(structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if si.Name != "" && si.UsesClock() {
+			si.FakeClock = true
+		}
+	}
+}
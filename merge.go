@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// baseDir holds, next to the generated files, the pristine copy of the last
+// generation that -merge uses as the common ancestor of a three-way merge.
+const baseDir = ".twintest"
+
+// basePath returns where the pristine generation of filename is kept.
+func basePath(filename string) string {
+	return filepath.Join(filepath.Dir(filename), baseDir, filepath.Base(filename))
+}
+
+// writeMerged writes a new generation of filename, merging it with the user's
+// edits to the previous one: structural updates land, edits survive, and
+// overlapping changes are left as conflict markers. A file edited since a
+// generation without -merge has no ancestor and is left alone.
+func writeMerged(filename string, content []byte) (written bool, err error) {
+	current, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		current = nil
+	} else if err != nil {
+		return false, err
+	}
+
+	base, err := os.ReadFile(basePath(filename))
+	if errors.Is(err, fs.ErrNotExist) && current != nil && !bytes.Equal(current, content) {
+		logEvent(os.Stderr, eventWarning, fmt.Sprintf("warning: %s has no previous generation to merge with, left as is; rerun without -merge to overwrite it", filename),
+			"file", filename)
+		return false, nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+
+	merged, conflicts := merge3(base, current, content)
+	if current == nil {
+		merged = content
+	}
+	if conflicts > 0 {
+		logEvent(os.Stderr, eventWarning, fmt.Sprintf("warning: %s: %d conflicts between edits and regeneration, marked in the file", filename, conflicts),
+			"file", filename, "conflicts", conflicts)
+	}
+	if err := saveBase(filename, content); err != nil {
+		return false, err
+	}
+	if current != nil && bytes.Equal(current, merged) {
+		return false, nil
+	}
+	return true, os.WriteFile(filename, merged, 0644)
+}
+
+// saveBase records content as the pristine generation of filename.
+func saveBase(filename string, content []byte) error {
+	path := basePath(filename)
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// merge3 merges the line-wise changes from base to ours and from base to
+// theirs. Where both sides changed the same lines differently, the result
+// holds both versions between conflict markers, ours first.
+func merge3(base, ours, theirs []byte) (merged []byte, conflicts int) {
+	o, a, b := splitLines(base), splitLines(ours), splitLines(theirs)
+	ma, mb := matchLines(o, a), matchLines(o, b)
+
+	var out bytes.Buffer
+	emit := func(lines [][]byte) {
+		for _, l := range lines {
+			out.Write(l)
+		}
+	}
+	i, j, k := 0, 0, 0
+	for {
+		// the next base line both sides kept, which anchors the chunk before it
+		next := i
+		for next < len(o) && (ma[next] < j || mb[next] < k) {
+			next++
+		}
+		endA, endB := len(a), len(b)
+		if next < len(o) {
+			endA, endB = ma[next], mb[next]
+		}
+
+		chunkO, chunkA, chunkB := o[i:next], a[j:endA], b[k:endB]
+		switch {
+		case equalLines(chunkA, chunkO):
+			emit(chunkB)
+		case equalLines(chunkB, chunkO), equalLines(chunkA, chunkB):
+			emit(chunkA)
+		default:
+			conflicts++
+			out.WriteString("<<<<<<< edited\n")
+			emit(chunkA)
+			out.WriteString("=======\n")
+			emit(chunkB)
+			out.WriteString(">>>>>>> generated\n")
+		}
+
+		if next == len(o) {
+			return out.Bytes(), conflicts
+		}
+		out.Write(o[next])
+		i, j, k = next+1, endA+1, endB+1
+	}
+}
+
+// matchLines pairs the lines of a longest common subsequence of base and
+// other: m[i] is the index in other of base line i, or -1 if it was removed.
+func matchLines(base, other [][]byte) []int {
+	n, m := len(base), len(other)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if bytes.Equal(base[i], other[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	match := make([]int, n)
+	for i := range match {
+		match[i] = -1
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case bytes.Equal(base[i], other[j]):
+			match[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+// splitLines splits text after each newline, keeping the newlines.
+func splitLines(text []byte) [][]byte {
+	lines := bytes.SplitAfter(text, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equalLines(x, y [][]byte) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if !bytes.Equal(x[i], y[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TestName is a test or subtest of the generated files as go test, and so
+// gotestsum's JUnit report, names it, with the branch it covers if any.
+type TestName struct {
+	Classname string `json:"classname"`          // import path of the package, the JUnit classname
+	Name      string `json:"name"`               // full name, e.g. TestFooTestSuite/Test_Get/err_!=_nil
+	File      string `json:"file"`               // test file declaring it
+	Line      int    `json:"line"`               // line of its declaration or t.Run call
+	Function  string `json:"function,omitempty"` // Receiver.Method or Func it tests
+	Branch    int    `json:"branch,omitempty"`   // line of the branch in the source, from its // @line ID
+	Code      string `json:"code,omitempty"`     // source of the branch
+	Source    string `json:"source,omitempty"`   // file of the branch
+}
+
+// runNames implements `twintest names [path ...]`, listing the names of the
+// tests next to the given sources as JSON, for test reports to show which
+// branch each case covers.
+func runNames(args []string) error {
+	flags := flag.NewFlagSet("names", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest names [file.go | dir | dir/...]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+	names, err := testNames(files)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(names)
+}
+
+// branchSource is a branch as testNames reports it.
+type branchSource struct {
+	file string
+	code string
+}
+
+// testNames names the tests in the directories of files.
+func testNames(files []string) ([]TestName, error) {
+	branches := make(map[string]map[string]branchSource) // dir -> "Func@line" -> branch
+	var dirs []string
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if branches[dir] == nil {
+			branches[dir] = make(map[string]branchSource)
+			dirs = append(dirs, dir)
+		}
+		structInfo, _, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, si := range structInfo {
+			if si.IsInterface {
+				continue
+			}
+			for _, fn := range si.Methods {
+				name := fn.Name
+				if fn.Receiver != "" {
+					name = fn.Receiver + "." + fn.Name
+				}
+				for _, b := range flattenBranches(fn.Branches) {
+					branches[dir][name+"@"+strconv.Itoa(b.Line)] = branchSource{file: file, code: b.CodeLine}
+				}
+			}
+		}
+	}
+
+	names := []TestName{}
+	for _, dir := range dirs {
+		classname, err := packagePath(dir)
+		if err != nil {
+			classname = filepath.ToSlash(dir)
+		}
+		tests, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+		if err != nil {
+			return nil, err
+		}
+		parsed := make(map[string]*ast.File)
+		fset := token.NewFileSet()
+		declared := make(map[string]bool)
+		for _, test := range tests {
+			f, err := parser.ParseFile(fset, test, nil, parser.ParseComments|parser.SkipObjectResolution)
+			if err != nil {
+				return nil, err
+			}
+			parsed[test] = f
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+					declared[fn.Name.Name] = true
+				}
+			}
+		}
+
+		for _, test := range tests {
+			f := parsed[test]
+			ids := make(map[int]int) // line -> branch ID
+			for _, group := range f.Comments {
+				for _, c := range group.List {
+					if m := branchID.FindStringSubmatch(c.Text); m != nil {
+						ids[fset.Position(c.Pos()).Line], _ = strconv.Atoi(m[1])
+					}
+				}
+			}
+			for _, decl := range f.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || !strings.HasPrefix(fn.Name.Name, "Test") || fn.Body == nil {
+					continue
+				}
+				name, function := fn.Name.Name, strings.TrimPrefix(fn.Name.Name, "Test_")
+				if recv := GetReceiverType(fn); recv != "" {
+					typ := strings.TrimSuffix(recv, "TestSuite")
+					entry := "Test" + upperFirst(typ) + "TestSuite"
+					if !declared[entry] {
+						entry = "TestSuites_" + typ
+					}
+					name, function = entry+"/"+name, typ+"."+function
+				} else if !strings.HasPrefix(fn.Name.Name, "Test_") {
+					continue
+				}
+				add := func(name string, pos token.Pos) {
+					line := fset.Position(pos).Line
+					tn := TestName{Classname: classname, Name: name, File: test, Line: line}
+					if id, ok := ids[line]; ok {
+						if b, ok := branches[dir][function+"@"+strconv.Itoa(id)]; ok {
+							tn.Function, tn.Branch, tn.Code, tn.Source = function, id, b.code, b.file
+						}
+					}
+					names = append(names, tn)
+				}
+				add(name, fn.Pos())
+				subtests(fn.Body, name, add)
+			}
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool { return names[i].Classname < names[j].Classname })
+	return names, nil
+}
+
+// subtests calls add with the full name of every t.Run subtest under body,
+// whose parent is named parent.
+func subtests(body ast.Node, parent string, add func(string, token.Pos)) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		lit, isLit := call.Args[0].(*ast.BasicLit)
+		fn, isFunc := call.Args[1].(*ast.FuncLit)
+		if !ok || sel.Sel.Name != "Run" || !isLit || lit.Kind != token.STRING || !isFunc {
+			return true
+		}
+		text, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		name := parent + "/" + subtestName(text)
+		add(name, call.Pos())
+		subtests(fn.Body, name, add)
+		return false
+	})
+}
+
+// subtestName rewrites a t.Run name as the testing package does: spaces
+// become underscores and unprintable runes are escaped.
+func subtestName(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			b.WriteByte('_')
+		case !strconv.IsPrint(r):
+			s := strconv.QuoteRune(r)
+			b.WriteString(s[1 : len(s)-1])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package main
+
+import "slices"
+
+// markParallel applies the parallel config: suites run in parallel with
+// parallel.suites, package function tests with parallel.methods, except
+// those listed in parallel.serial and those that must not share the process.
+func markParallel(structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if si.IsInterface {
+			continue
+		}
+		if si.Name == "" {
+			// every test of the file resets the package variables any of
+			// them writes, so one writer keeps them all serial
+			shared := len(si.Globals()) > 0
+			for i := range si.Methods {
+				fn := &si.Methods[i]
+				fn.Parallel = config.Parallel.Methods && !slices.Contains(config.Parallel.Serial, fn.Name) && !fn.processWide() && !shared
+			}
+			continue
+		}
+		si.Parallel = config.Parallel.Suites && !slices.Contains(config.Parallel.Serial, si.Name) && !si.LoggerGlobal
+		for i := range si.Methods {
+			if si.Methods[i].processWide() {
+				si.Parallel = false
+			}
+		}
+	}
+}
+
+// processWide reports whether fn's test changes state of the whole process:
+// t.Setenv and the working directory cannot be used by parallel tests, and
+// package variables and flag.CommandLine would be reset under the feet of
+// other tests, and testing.AllocsPerRun panics in a parallel test.
+func (fn FuncInfo) processWide() bool {
+	return len(fn.EnvVars) > 0 || len(fn.ReadPaths) > 0 || len(fn.Globals) > 0 || fn.SetsFlags || fn.Hot != nil
+}
@@ -5,7 +5,9 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -25,6 +27,11 @@ const (
 	BranchCommClauseDefault
 	BranchBlock
 	BranchReturn
+	BranchBreak       // early exit from a loop, switch or select
+	BranchContinue    // early exit from a loop iteration
+	BranchFallthrough // early exit into the next switch case
+	BranchCall        // branches of a called helper, inlined by -inline-depth
+	BranchPanic       // a panic(...) call statement, which ends the path like a return
 )
 
 // Branch represents a control-flow branch (if, for, switch case, return, etc.)
@@ -33,10 +40,19 @@ type Branch struct {
 	Line      int
 	CodeLine  string
 	Children  []*Branch
-	hasReturn bool // internal memo: true if this or any descendant is a return path
+	Wraps     []string // sentinel errors wrapped by a return via %w or errors.Join
+	Init      string   // init statement of an if or switch, e.g. "err := do()"
+	Dead      string   // why constant conditions make the branch unreachable, if they do
+	Panic     string   // argument of a BranchPanic, as in the source
+	Bound     string   // n of an integer range loop, for i := range n
+	Naked     string   // named results a bare return returns, e.g. "n, err"
+	Returns   []string // results of a return made only of literals and constants, e.g. 0, ErrNotFound
+	Collapsed int      // paths below the branch that -max-depth folded into it
+	hasReturn bool     // internal memo: true if this or any descendant is a return path
 }
 
-// HasReturn returns true if this branch or any of its descendants leads to a return statement.
+// HasReturn returns true if this branch or any of its descendants leads to a return statement,
+// or to an early exit by break, continue or fallthrough, which is as much a path out.
 // It caches the result by setting hasReturn = true when a return is found downstream.
 func (b *Branch) HasReturn() bool {
 	if b.hasReturn {
@@ -51,18 +67,333 @@ func (b *Branch) HasReturn() bool {
 	return false
 }
 
+// Name is a readable subtest name for the branch, derived from its code. A
+// bare return is named after the results it returns.
+func (b *Branch) Name() string {
+	if b.Naked != "" {
+		return caseName("return "+b.Naked, b.Line)
+	}
+	return caseName(b.CodeLine, b.Line)
+}
+
+// PanicCheck opens the testify assertion for a BranchPanic, up to the
+// function under test: PanicsWithValue for a literal value, PanicsWithError
+// for errors.New or fmt.Errorf with a constant message, and plain Panics
+// when the value is only known at run time. It is "" for other branches.
+func (b *Branch) PanicCheck() string {
+	if b.Type != BranchPanic {
+		return ""
+	}
+	expr, err := parser.ParseExpr(b.Panic)
+	if err != nil {
+		return "Panics(t, "
+	}
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return "PanicsWithValue(t, " + e.Value + ", "
+	case *ast.CallExpr:
+		name := ""
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok {
+				name = x.Name + "." + sel.Sel.Name
+			}
+		}
+		if name != "errors.New" && name != "fmt.Errorf" || len(e.Args) != 1 {
+			break
+		}
+		if lit, ok := e.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING && !strings.Contains(lit.Value, "%") {
+			return "PanicsWithError(t, " + lit.Value + ", "
+		}
+	}
+	return "Panics(t, "
+}
+
+// BoundHint suggests the boundary cases of an integer range loop whose
+// bound the test controls, or "" for other branches.
+func (b *Branch) BoundHint() string {
+	if b.Bound == "" {
+		return ""
+	}
+	if _, err := strconv.Atoi(b.Bound); err == nil {
+		return ""
+	}
+	return fmt.Sprintf("%[1]s = 0 时不进入循环, %[1]s = 1 时只迭代一次, 再取一个较大的 %[1]s", b.Bound)
+}
+
+// InitHint describes what a test must arrange for the branch's init
+// statement, such as "需要 do() 返回错误" for `if err := do(); err != nil`,
+// or "" if it has none.
+func (b *Branch) InitHint() string {
+	if b.Init == "" {
+		return ""
+	}
+	call := b.Init
+	if _, rhs, ok := strings.Cut(b.Init, "="); ok {
+		call = strings.TrimSpace(rhs)
+	}
+	cond := b.CodeLine
+	if i := strings.Index(cond, b.Init); i >= 0 {
+		cond = strings.TrimSpace(strings.TrimPrefix(cond[i+len(b.Init):], ";"))
+	}
+
+	switch {
+	case b.Type == BranchSwitch || b.Type == BranchTypeSwitch:
+		return "需要控制 " + call + " 的结果以命中各 case"
+	case strings.HasSuffix(cond, "err != nil"):
+		return "需要 " + call + " 返回错误"
+	case strings.HasSuffix(cond, "err == nil"):
+		return "需要 " + call + " 成功"
+	case cond == "!ok":
+		return "需要 " + call + " 返回 ok == false"
+	case cond == "ok":
+		return "需要 " + call + " 返回 ok == true"
+	}
+	return "需要 " + call + " 的结果满足 " + cond
+}
+
+// Field is a single parameter or result of a function signature, or a
+// struct field. Type is spelled as in the source, `...T` for a variadic one.
+type Field struct {
+	Name     string
+	Type     string
+	Variadic bool
+	Tag      string // tag of a struct field, unquoted, e.g. `json:"id"`
+}
+
+// Key is how a composite literal names the field: its name, or for an
+// embedded field its type name, e.g. "Mutex" for sync.Mutex.
+func (f Field) Key() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	typ := strings.TrimPrefix(f.Type, "*")
+	if i := strings.IndexByte(typ, '['); i >= 0 {
+		typ = typ[:i]
+	}
+	return typ[strings.LastIndexByte(typ, '.')+1:]
+}
+
+// Elem returns the element type of a variadic parameter, or Type otherwise.
+func (f Field) Elem() string {
+	return strings.TrimPrefix(f.Type, "...")
+}
+
+// anyBranch reports whether pred holds for any branch in the trees rooted at branches.
+func anyBranch(branches []*Branch, pred func(*Branch) bool) bool {
+	for _, b := range branches {
+		if pred(b) || anyBranch(b.Children, pred) {
+			return true
+		}
+	}
+	return false
+}
+
+// Impl is a struct implementing an interface, with whether it takes a
+// pointer to the struct to satisfy the interface.
+type Impl struct {
+	Name    string
+	Pointer bool
+}
+
+// flattenBranches lists every branch in the trees rooted at branches, parents
+// before their children.
+func flattenBranches(branches []*Branch) []*Branch {
+	var flat []*Branch
+	for _, b := range branches {
+		flat = append(flat, b)
+		flat = append(flat, flattenBranches(b.Children)...)
+	}
+	return flat
+}
+
+// leafPaths lists every chain of branches from a root down to a leaf.
+func leafPaths(branches []*Branch) [][]*Branch {
+	var paths [][]*Branch
+	for _, b := range branches {
+		if len(b.Children) == 0 {
+			paths = append(paths, []*Branch{b})
+			continue
+		}
+		for _, tail := range leafPaths(b.Children) {
+			paths = append(paths, append([]*Branch{b}, tail...))
+		}
+	}
+	return paths
+}
+
+// returnsOnly copies the trees rooted at branches, keeping only the branches
+// that lead to a return, as -paths=return does, without touching the input.
+func returnsOnly(branches []*Branch) []*Branch {
+	var kept []*Branch
+	for _, b := range branches {
+		if !b.HasReturn() {
+			continue
+		}
+		cp := *b
+		cp.Children = returnsOnly(b.Children)
+		kept = append(kept, &cp)
+	}
+	return kept
+}
+
+// branchDepth returns the number of levels in the deepest tree rooted at branches.
+func branchDepth(branches []*Branch) int {
+	depth := 0
+	for _, b := range branches {
+		depth = max(depth, 1+branchDepth(b.Children))
+	}
+	return depth
+}
+
+// FuncField is a struct field of function type, such as a hook or callback.
+// Unnamed parameters are given positional names so closures can refer to them.
+type FuncField struct {
+	Name    string
+	Type    string
+	Params  []Field
+	Results []Field
+}
+
+// countBranches returns the number of branches in the trees rooted at branches.
+func countBranches(branches []*Branch) int {
+	n := len(branches)
+	for _, b := range branches {
+		n += countBranches(b.Children)
+	}
+	return n
+}
+
 type FuncInfo struct {
 	//IsMethod   bool
-	Receiver   string
-	Name       string
-	IsExported bool
-	Branches   []*Branch
+	Receiver    string
+	RecvName    string // receiver identifier, e.g. "c" in `func (c *Client)`
+	Sut         string // the suite field a method is called on, see StructInfo.Sut
+	PtrRecv     bool   // declared on the pointer receiver
+	Name        string
+	IsExported  bool
+	Params      []Field
+	Results     []Field
+	Branches    []*Branch
+	Sentinels   []string            // package-level sentinel errors returned as-is
+	Calls       map[string]bool     // package-qualified calls by import path, e.g. "time.Now"
+	EnvVars     []EnvVar            // environment variables read via os.Getenv/os.LookupEnv
+	ReadPaths   []string            // relative paths of the files it reads, as literals
+	FSPaths     map[string][]string // files opened by literal names, by the field or parameter of their file system
+	FSParams    []FSDep             // its file system parameters
+	FieldRefs   map[string]bool     // receiver fields the body refers to
+	Hooks       []string            // function-typed receiver fields the body refers to
+	IsAccessor  bool                // trivial getter or setter of a receiver field
+	IsWrapper   bool                // body only forwards its arguments to another call
+	Binary      *MainBinary         // the command main builds, for the main function of package main
+	Cobra       *CobraCommand       // the cobra command it builds, when it returns one
+	Handler     *Handler            // the router it serves requests for, when its signature is a handler's
+	Cases       []CaseHint          // cases declared with //twintest:case
+	Specs       []InlineSpec        // concrete examples declared with //twintest: f(x) => y
+	Hot         *HotPath            // declared performance-critical with //twintest:hot
+	Output      *ExampleOutput      // what it prints through fmt, for an Example; nil if nothing
+	UsesSQL     bool                // talks to a database through database/sql
+	Queries     []SQLQuery          // SQL statements in its body, for the sqlmock expectations
+	UsesHTTP    bool                // makes outbound requests through net/http
+	Snapshot    bool                // assert results with a snapshot instead of a placeholder
+	Compare     string              // type of the result diffed with go-cmp, with -style=cmp
+	CmpOpts     []string            // cmp.Options the diff needs for the result type
+	Generic     bool                // declares type parameters of its own
+	DataFiles   bool                // its cases are read from files under testdata/, with -data-files
+	Synctest    bool                // its leaf cases run in a testing/synctest bubble, on a fake clock
+	CtxParam    string              // its context.Context parameter, when its body checks for cancellation
+	Line        int                 // line of the declaration, for ordering
+	EndLine     int                 // line of the closing brace
+	LocalCalls  map[string]bool     // calls within the package, "F" or "Type.Method"
+	Recursive   bool                // calls itself, directly or through RecursesVia
+	RecursesVia string              // first function of an indirect recursion, if any
+	Globals     []string            // package-level variables it assigns, sorted
+	SetsFlags   bool                // registers flags on flag.CommandLine, swapped for a fresh set in its tests
+	Options     []FuncInfo          // the functions building options for its variadic functional-options parameter
+	Parallel    bool                // its test runs in parallel with the others, by the parallel config
+	Operands    map[string]bool     // names besides its parameters a suggested input may use: constants and imports of its file
 }
 
 type StructInfo struct {
-	Name       string
-	IsExported bool
-	Methods    []FuncInfo
+	Name         string
+	IsExported   bool
+	IsInterface  bool // an interface whose method set gets a contract suite
+	Fields       []Field
+	FuncFields   []FuncField
+	Methods      []FuncInfo
+	Imports      []string           // import specs the generated file needs beyond the fixed ones
+	Logger       string             // logging library the suite injects a test logger for
+	LoggerGlobal bool               // methods log through the library's package-level logger
+	FakeClock    bool               // the suite carries a fake clock for time.Now users
+	Rand         string             // math/rand import path the suite seeds a source for
+	SQL          bool               // the suite sets up go-sqlmock for database/sql access
+	HTTP         bool               // the suite starts an httptest.Server for outbound calls
+	URLField     string             // field likely holding the upstream URL, if any
+	Mutex        string             // sync.Mutex or sync.RWMutex field guarding the struct, if any
+	IO           *IOImpl            // the io interfaces the struct implements, if any
+	Constructors []FuncInfo         // package functions returning a new T or *T
+	Ctor         *FuncInfo          // the constructor SetupTest calls, if any
+	CtorHint     string             // constructor named by //twintest:ctor
+	CtorStubs    bool               // the other constructors are tested in the suite, not on their own
+	BlackBox     bool               // the suite goes in the external _test package, seeing only exported API
+	File         string             // test file named by //twintest:file, instead of the default
+	Base         *BaseSuite         // the package's own base suite, embedded instead of suite.Suite
+	FSFields     []FSDep            // file system fields, stood in for by a fstest.MapFS
+	Impls        []Impl             // structs in the file implementing the interface
+	Sut          string             // the suite field holding the struct under test, named after its receivers
+	SutPointer   bool               // the sut must be a *T for its whole method set to be callable
+	ValueMethods []string           // value-receiver methods, which cannot mutate a pointer sut
+	TypeParams   string             // type parameter list of a generic struct, e.g. "[K comparable, V any]"
+	TypeArgs     string             // the type parameters as arguments, e.g. "[K, V]"
+	Instances    []string           // type arguments to run a generic suite with, e.g. "int, string"
+	Line         int                // line of the declaration, for ordering; 0 for package functions
+	Partial      bool               // only some methods are kept, to be spliced into the existing file
+	Fixtures     bool               // shared helpers come from the package's -fixtures file
+	Runner       bool               // the package's -runner file runs the suite, not a test of its own
+	Parallel     bool               // the suite runs in parallel with the other tests, by the parallel config
+	Templates    *EmbeddedTemplates // templates the file embeds, tested with the package functions
+	JSON         []JSONField        // json-tagged fields, for a round-trip test
+	Init         *InitEffects       // side effects of the file's init functions, tested in a file of their own
+
+	fileImports map[string]string // imports of the source file, by local name
+	embeds      bool              // interface embeds others, so its method set is unknown
+}
+
+// HasRequire reports whether the generated file asserts with testify's require
+// package: for built binaries, cobra commands and handlers, wrapped or
+// directly returned sentinels, hook call counts, inline specs, returned
+// function values or iterators, panic paths, literal returns, allocation
+// budgets, io checks, embedded templates or json tags.
+func (si *StructInfo) HasRequire() bool {
+	if si.Templates != nil || si.HasJSON() {
+		return true
+	}
+	for i := range si.Methods {
+		method := si.Methods[i]
+		specs := len(method.Specs) > 0 && (method.Compare == "" || method.ReturnsError())
+		if method.Binary != nil || method.Cobra != nil || method.Handler != nil || method.DataFiles || len(method.ReadPaths) > 0 || method.CtxParam != "" && method.ReturnsError() || method.HasIters() || len(method.Sentinels) > 0 || len(method.Hooks) > 0 || specs || method.ReturnsFunc() || method.Hot != nil || si.IO != nil {
+			return true
+		}
+		if anyBranch(si.Methods[i].Branches, func(b *Branch) bool { return len(b.Wraps) > 0 || b.Type == BranchPanic || method.prefills(b) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSnapshot reports whether any method asserts its results with a snapshot.
+func (si *StructInfo) HasSnapshot() bool {
+	for i := range si.Methods {
+		if si.Methods[i].Snapshot {
+			return true
+		}
+	}
+	return false
+}
+
+// SuiteType spells the generated suite type, with the struct's type
+// parameters when it is generic.
+func (si *StructInfo) SuiteType() string {
+	return si.Name + "TestSuite" + si.TypeArgs
 }
 
 func ParseFile(filename string) ([]*StructInfo, string, error) {
@@ -71,33 +402,68 @@ func ParseFile(filename string) ([]*StructInfo, string, error) {
 		return nil, "", err
 	}
 	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	node, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
 	if err != nil {
 		return nil, "", err
 	}
 	//src := bytes.Split(srcBytes, []byte("\n"))
 
+	fileImports := importTable(node)
+	sentinels := packageSentinels(node)
+	operands := packageConsts(node, fileImports)
+	globals := packageVars(node)
+	options := optionTypes(node)
+	local := localTypes(node)
+	consts := constEnv(node, filename, fileImports)
+
 	structs := make([]*StructInfo, 0)
 	structTypes := make(map[string]*StructInfo)
 	for _, decl := range node.Decls {
 		if genDecl, ok := decl.(*ast.GenDecl); ok {
 			for _, spec := range genDecl.Specs {
 				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
-					if _, ok := typeSpec.Type.(*ast.StructType); ok {
+					if structType, ok := typeSpec.Type.(*ast.StructType); ok {
+						doc := typeSpec.Doc
+						if doc == nil {
+							doc = genDecl.Doc
+						}
 						info := &StructInfo{
 							Name:       typeSpec.Name.Name,
 							IsExported: ast.IsExported(typeSpec.Name.Name),
+							TypeParams: fieldListCode(typeSpec.TypeParams, fset, src),
+							TypeArgs:   typeArgs(typeSpec.TypeParams),
+							Instances:  typeInstances(doc),
+							CtorHint:   ctorHint(doc),
+							BlackBox:   hasDirective(doc, "blackbox"),
+							File:       fileHint(doc),
+							Line:       fset.Position(typeSpec.Pos()).Line,
+							Fields:     extractFields(structType.Fields, fset, src),
+							FuncFields: extractFuncFields(structType.Fields, fset, src),
 						}
+						info.JSON = jsonFields(info.Fields, local)
 						structTypes[typeSpec.Name.Name] = info
 						structs = append(structs, info)
 					}
+					if ifaceType, ok := typeSpec.Type.(*ast.InterfaceType); ok && typeSpec.TypeParams == nil {
+						structs = append(structs, &StructInfo{
+							Name:        typeSpec.Name.Name,
+							IsExported:  ast.IsExported(typeSpec.Name.Name),
+							IsInterface: true,
+							Line:        fset.Position(typeSpec.Pos()).Line,
+							Methods:     extractInterfaceMethods(typeSpec.Name.Name, ifaceType, fset, src),
+							embeds:      hasEmbedded(ifaceType),
+						})
+					}
 				}
 			}
 		}
 	}
 
 	if _, ok := structTypes[""]; !ok {
-		dummy := &StructInfo{}
+		dummy := &StructInfo{
+			Templates: embeddedTemplates(node, fileImports),
+			Init:      collectInitEffects(node, fileImports, globals),
+		}
 		structTypes[""] = dummy
 		structs = append(structs, dummy)
 	}
@@ -106,39 +472,362 @@ func ParseFile(filename string) ([]*StructInfo, string, error) {
 		if fn, ok := decl.(*ast.FuncDecl); ok {
 			receiverType := GetReceiverType(fn)
 			si := structTypes[receiverType]
+			if si == nil {
+				continue // method of a non-struct type
+			}
+			if isInit(fn) {
+				continue // tested through the state it leaves
+			}
 
-			branches := ExtractBranches(fn.Body, fset, src)
+			body := iteratorBody(fn)
+			cobra := detectCobra(fn, fileImports)
+			if cobra != nil && cobra.body != nil {
+				body = cobra.body // the branches to cover are those of running the command
+			}
+			branches := ExtractBranches(body, fset, src)
+			markDead(body, branches, consts, fset)
+			locals := localVars(body)
+			anyBranch(branches, func(b *Branch) bool {
+				b.Wraps = importedWraps(b.Wraps, fileImports, locals)
+				return false
+			})
 
+			recvName := GetReceiverName(fn)
+			params := extractFields(fn.Type.Params, fset, src)
+			results := extractFields(fn.Type.Results, fset, src)
+			handler := detectHandler(fn, params, results, fileImports)
+			markIntRanges(body, branches, params, fset)
+			if cobra == nil {
+				markNakedReturns(branches, results)
+			}
+			if *precise {
+				markInfeasible(body, branches, params, consts, fset)
+			}
+			if fn.Type.TypeParams == nil && si.TypeParams == "" && cobra == nil && handler == nil {
+				markLiteralReturns(body, branches, func(name string) bool {
+					_, isConst := consts.decls[node.Scope.Lookup(name)]
+					return isConst || sentinels[name]
+				}, fileImports, fset)
+			}
+			var binary *MainBinary
+			if node.Name.Name == "main" && fn.Recv == nil && fn.Name.Name == "main" {
+				binary = &MainBinary{Flags: mainFlags(node, fn, fileImports)}
+			}
 			info := FuncInfo{
 				Name: fn.Name.Name,
 				//IsMethod:   fn.Recv != nil,
 				Receiver:   receiverType,
+				RecvName:   recvName,
+				PtrRecv:    isPtrReceiver(fn),
+				Params:     params,
+				Results:    results,
 				Branches:   branches,
+				Sentinels:  returnedSentinels(fn.Body, sentinels),
+				Calls:      collectCalls(fn.Body, fileImports),
+				Queries:    collectQueries(fn.Body),
+				EnvVars:    collectEnvVars(fn.Body, fileImports),
+				ReadPaths:  collectReadPaths(fn.Body, fileImports),
+				CtxParam:   cancellableParam(fn.Body, params, fileImports),
+				FieldRefs:  collectFieldRefs(fn.Body, recvName),
+				FSPaths:    collectFSPaths(fn.Body, recvName, fileImports),
+				IsAccessor: isAccessor(fn.Body, recvName),
+				IsWrapper:  binary == nil && isWrapper(fn.Body, recvName, params),
+				Binary:     binary,
+				Cobra:      cobra,
+				Handler:    handler,
+				Cases:      caseHints(fn.Doc),
+				Specs:      inlineSpecs(fn.Doc, params, results),
+				Hot:        hotPath(fn.Doc),
+				Output:     inferOutput(fn.Body, fileImports, params),
 				IsExported: ast.IsExported(fn.Name.Name),
+				Generic:    fn.Type.TypeParams != nil,
+				Line:       fset.Position(fn.Pos()).Line,
+				EndLine:    fset.Position(fn.End()).Line,
+				LocalCalls: collectLocalCalls(fn.Body, receiverType, recvName, si.Fields),
+				Globals:    collectGlobalWrites(fn.Body, globals),
+				SetsFlags:  binary == nil && registersFlags(fn.Body, fileImports),
+				Operands:   operands,
 			}
 
 			si.Methods = append(si.Methods, info)
 		}
 	}
+
+	for _, si := range structs {
+		if si.IsInterface && !si.embeds {
+			si.Impls = findImpls(si, structs)
+		}
+		detectMethodSet(si)
+	}
+	detectRecursion(structs)
+	detectOptions(structs, options)
+	detectConstructors(structs)
+
+	for _, si := range structs {
+		si.fileImports = fileImports
+		nameSut(si)
+		detectLogger(si, fileImports)
+		detectRand(si, fileImports)
+		detectSQL(si, fileImports)
+		detectHTTP(si, fileImports)
+		detectMutex(si, fileImports)
+		detectIO(si, fileImports)
+		detectFS(si, fileImports)
+		detectHooks(si)
+	}
 	return structs, node.Name.Name, nil
 }
 
+// packageSentinels returns the package-level error values declared in the
+// file, such as `var ErrNotFound = errors.New("not found")`.
+func packageSentinels(node *ast.File) map[string]bool {
+	sentinels := make(map[string]bool)
+	for _, decl := range node.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec := spec.(*ast.ValueSpec)
+			for i, value := range valueSpec.Values {
+				call, ok := value.(*ast.CallExpr)
+				if !ok || i >= len(valueSpec.Names) {
+					continue
+				}
+				if name := callName(call); name == "errors.New" || name == "fmt.Errorf" {
+					sentinels[valueSpec.Names[i].Name] = true
+				}
+			}
+		}
+	}
+	return sentinels
+}
+
+// packageConsts returns the names a test of the file can compare with in
+// place of a literal: its package-level constants, and the local names of
+// its imports, whose exported constants are as good.
+func packageConsts(node *ast.File, imports map[string]string) map[string]bool {
+	names := make(map[string]bool)
+	for _, decl := range node.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				names[name.Name] = true
+			}
+		}
+	}
+	for local := range imports {
+		names[local] = true
+	}
+	return names
+}
+
+// returnedSentinels lists, in order of appearance, the sentinels that body
+// returns directly. Returns inside function literals are not the caller's.
+func returnedSentinels(body *ast.BlockStmt, sentinels map[string]bool) []string {
+	var found []string
+	seen := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			for _, result := range n.Results {
+				if id, ok := result.(*ast.Ident); ok && sentinels[id.Name] && !seen[id.Name] {
+					seen[id.Name] = true
+					found = append(found, id.Name)
+				}
+			}
+		}
+		return true
+	})
+	return found
+}
+
 func GetReceiverType(fn *ast.FuncDecl) string {
 	if fn.Recv == nil || len(fn.Recv.List) == 0 {
 		return ""
 	}
 	recv := fn.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
 	switch r := recv.(type) {
-	case *ast.Ident:
-		return r.Name
-	case *ast.StarExpr:
-		if id, ok := r.X.(*ast.Ident); ok {
-			return id.Name
+	case *ast.IndexExpr:
+		recv = r.X
+	case *ast.IndexListExpr:
+		recv = r.X
+	}
+	if id, ok := recv.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// typeArgs lists the names of type parameters as type arguments, such as
+// "[K, V]" for "[K comparable, V any]", or "" if there are none.
+func typeArgs(list *ast.FieldList) string {
+	if list == nil {
+		return ""
+	}
+	var names []string
+	for _, field := range list.List {
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// fieldListCode returns the source text of a bracketed list such as type
+// parameters, or "" if there is none.
+func fieldListCode(list *ast.FieldList, fset *token.FileSet, src []byte) string {
+	if list == nil {
+		return ""
+	}
+	start := fset.Position(list.Pos()).Offset
+	end := fset.Position(list.End()).Offset
+	return string(src[start:end])
+}
+
+// extractFields flattens a parameter or result list, expanding grouped names
+// such as `a, b int` into one Field per name.
+func extractFields(list *ast.FieldList, fset *token.FileSet, src []byte) []Field {
+	if list == nil {
+		return nil
+	}
+	var fields []Field
+	for _, f := range list.List {
+		start := fset.Position(f.Type.Pos()).Offset
+		end := fset.Position(f.Type.End()).Offset
+		typ := string(src[start:end])
+		_, variadic := f.Type.(*ast.Ellipsis)
+		tag := ""
+		if f.Tag != nil {
+			tag, _ = strconv.Unquote(f.Tag.Value)
+		}
+		if len(f.Names) == 0 {
+			fields = append(fields, Field{Type: typ, Variadic: variadic, Tag: tag})
+			continue
+		}
+		for _, name := range f.Names {
+			fields = append(fields, Field{Name: name.Name, Type: typ, Variadic: variadic, Tag: tag})
 		}
 	}
+	return fields
+}
+
+// isPtrReceiver reports whether a method is declared on a pointer receiver.
+func isPtrReceiver(fn *ast.FuncDecl) bool {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return false
+	}
+	_, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	return ok
+}
+
+// GetReceiverName returns the receiver identifier of a method, or "" for
+// functions and unnamed receivers.
+func GetReceiverName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 || len(fn.Recv.List[0].Names) == 0 {
+		return ""
+	}
+	if name := fn.Recv.List[0].Names[0].Name; name != "_" {
+		return name
+	}
 	return ""
 }
 
+// extractInterfaceMethods returns the explicitly declared methods of an
+// interface; embedded interfaces contribute nothing here.
+func extractInterfaceMethods(name string, iface *ast.InterfaceType, fset *token.FileSet, src []byte) []FuncInfo {
+	var methods []FuncInfo
+	for _, m := range iface.Methods.List {
+		funcType, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) == 0 {
+			continue
+		}
+		methods = append(methods, FuncInfo{
+			Name:       m.Names[0].Name,
+			Receiver:   name,
+			IsExported: ast.IsExported(m.Names[0].Name),
+			Params:     extractFields(funcType.Params, fset, src),
+			Results:    extractFields(funcType.Results, fset, src),
+		})
+	}
+	return methods
+}
+
+// hasEmbedded reports whether an interface embeds other interfaces or
+// type constraints alongside its methods.
+func hasEmbedded(iface *ast.InterfaceType) bool {
+	for _, m := range iface.Methods.List {
+		if len(m.Names) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// findImpls returns the structs among candidates whose methods cover every
+// method of iface by name and arity. Pointer receivers make the pointer the
+// implementation.
+func findImpls(iface *StructInfo, candidates []*StructInfo) []Impl {
+	var impls []Impl
+	for _, si := range candidates {
+		if si.Name == "" || si.IsInterface {
+			continue
+		}
+		impl := Impl{Name: si.Name}
+		covered := 0
+		for _, want := range iface.Methods {
+			for _, have := range si.Methods {
+				if have.Name == want.Name && len(have.Params) == len(want.Params) &&
+					len(have.Results) == len(want.Results) {
+					covered++
+					impl.Pointer = impl.Pointer || have.PtrRecv
+					break
+				}
+			}
+		}
+		if covered == len(iface.Methods) && covered > 0 {
+			impls = append(impls, impl)
+		}
+	}
+	return impls
+}
+
+// extractFuncFields returns the function-typed fields of a struct.
+func extractFuncFields(list *ast.FieldList, fset *token.FileSet, src []byte) []FuncField {
+	var fields []FuncField
+	for _, f := range list.List {
+		funcType, ok := f.Type.(*ast.FuncType)
+		if !ok {
+			continue
+		}
+		start := fset.Position(f.Type.Pos()).Offset
+		end := fset.Position(f.Type.End()).Offset
+		params := extractFields(funcType.Params, fset, src)
+		for i := range params {
+			if params[i].Name == "" || params[i].Name == "_" {
+				params[i].Name = fmt.Sprintf("arg%d", i)
+			}
+		}
+		for _, name := range f.Names {
+			fields = append(fields, FuncField{
+				Name:    name.Name,
+				Type:    string(src[start:end]),
+				Params:  params,
+				Results: extractFields(funcType.Results, fset, src),
+			})
+		}
+	}
+	return fields
+}
+
 func ExtractBranches(block *ast.BlockStmt, fset *token.FileSet, src []byte) []*Branch {
 	var children []*Branch
 	for _, stmt := range block.List {
@@ -166,6 +855,10 @@ func visitStmt(stmt ast.Stmt, fset *token.FileSet, src []byte, out *[]*Branch) {
 		b = parseSelectStmt(s, fset, src)
 	case *ast.BlockStmt:
 		b = parseBlockStmt(s, fset, src)
+	case *ast.BranchStmt:
+		b = parseBranchStmt(s, fset, src)
+	case *ast.ExprStmt:
+		b = parsePanicStmt(s, fset, src)
 	default:
 		// Ignore non-control-flow statements (assignments, exprs, etc.)
 		return
@@ -184,10 +877,202 @@ func parseReturnStmt(s *ast.ReturnStmt, fset *token.FileSet, src []byte) *Branch
 		Line:      lineNo,
 		CodeLine:  code,
 		Children:  nil,
+		Wraps:     wrappedErrors(s, fset, src),
+		hasReturn: true,
+	}
+}
+
+// parseBranchStmt marks a break, continue or fallthrough as the end of a
+// path; goto is left alone.
+func parseBranchStmt(s *ast.BranchStmt, fset *token.FileSet, src []byte) *Branch {
+	var typ int
+	switch s.Tok {
+	case token.BREAK:
+		typ = BranchBreak
+	case token.CONTINUE:
+		typ = BranchContinue
+	case token.FALLTHROUGH:
+		typ = BranchFallthrough
+	default:
+		return nil
+	}
+	return &Branch{
+		Type:      typ,
+		Line:      fset.Position(s.Pos()).Line,
+		CodeLine:  stmtCode(s, fset, src),
+		hasReturn: true,
+	}
+}
+
+// parsePanicStmt marks a call of the builtin panic as the end of a path;
+// other expression statements are not branches.
+func parsePanicStmt(s *ast.ExprStmt, fset *token.FileSet, src []byte) *Branch {
+	call, ok := s.X.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil
+	}
+	if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "panic" {
+		return nil
+	}
+	arg := call.Args[0]
+	return &Branch{
+		Type:      BranchPanic,
+		Line:      fset.Position(s.Pos()).Line,
+		CodeLine:  stmtCode(s, fset, src),
+		Panic:     string(src[fset.Position(arg.Pos()).Offset:fset.Position(arg.End()).Offset]),
 		hasReturn: true,
 	}
 }
 
+// wrappedErrors collects the sentinel errors a return statement wraps with
+// fmt.Errorf("...%w...") or errors.Join, e.g. `ErrNotFound` or `io.EOF`.
+func wrappedErrors(s *ast.ReturnStmt, fset *token.FileSet, src []byte) []string {
+	var wraps []string
+	for _, result := range s.Results {
+		call, ok := result.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		var args []ast.Expr
+		switch callName(call) {
+		case "errors.Join":
+			args = call.Args
+		case "fmt.Errorf":
+			if len(call.Args) == 0 {
+				continue
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				continue
+			}
+			format, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				continue
+			}
+			for _, i := range wrapVerbs(format) {
+				if i+1 < len(call.Args) {
+					args = append(args, call.Args[i+1])
+				}
+			}
+		}
+		for _, arg := range args {
+			if isSentinel(arg) {
+				start := fset.Position(arg.Pos()).Offset
+				end := fset.Position(arg.End()).Offset
+				wraps = append(wraps, string(src[start:end]))
+			}
+		}
+	}
+	return wraps
+}
+
+// importedWraps keeps the wrapped sentinels a test can name: package-level
+// variables, not those locals declares with var in the function, and those
+// of a package the file imports, rather than fields of a package variable.
+func importedWraps(wraps []string, imports map[string]string, locals map[string]bool) []string {
+	var kept []string
+	for _, expr := range wraps {
+		if pkg, _, ok := strings.Cut(expr, "."); ok && imports[pkg] != "" || !ok && !locals[expr] {
+			kept = append(kept, expr)
+		}
+	}
+	return kept
+}
+
+// localVars returns the names body declares with var statements.
+func localVars(body *ast.BlockStmt) map[string]bool {
+	names := make(map[string]bool)
+	if body == nil {
+		return names
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if decl, ok := n.(*ast.GenDecl); ok && decl.Tok == token.VAR {
+			for _, spec := range decl.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					names[name.Name] = true
+				}
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// callName returns the callee of a call as written, e.g. "fmt.Errorf".
+func callName(call *ast.CallExpr) string {
+	switch fn := call.Fun.(type) {
+	case *ast.Ident:
+		return fn.Name
+	case *ast.SelectorExpr:
+		if x, ok := fn.X.(*ast.Ident); ok {
+			return x.Name + "." + fn.Sel.Name
+		}
+	}
+	return ""
+}
+
+// wrapVerbs returns the operand indexes consumed by %w verbs in format,
+// following explicit indexes such as %[2]w and widths taken by *.
+func wrapVerbs(format string) []int {
+	var indexes []int
+	operand := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		for i < len(format) && strings.IndexByte("+-# 0123456789.*[", format[i]) >= 0 {
+			switch format[i] {
+			case '*':
+				operand++
+			case '[':
+				end := strings.IndexByte(format[i:], ']')
+				if end < 0 {
+					return indexes
+				}
+				n, err := strconv.Atoi(format[i+1 : i+end])
+				if err != nil || n < 1 {
+					return indexes
+				}
+				operand = n - 1
+				i += end
+			}
+			i++
+		}
+		if i < len(format) && format[i] == 'w' {
+			indexes = append(indexes, operand)
+		}
+		operand++
+	}
+	return indexes
+}
+
+// isSentinel reports whether expr names a package-level error value, such as
+// ErrNotFound, errClosed or io.EOF, rather than a local err variable or the
+// field of one. An identifier must be a variable declared by a var
+// statement, or in another file of the package; importedWraps drops those
+// the function declares itself.
+func isSentinel(expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		if !strings.HasPrefix(e.Name, "Err") && !strings.HasPrefix(e.Name, "err") || e.Name == "err" {
+			return false
+		}
+		if e.Obj == nil {
+			return true
+		}
+		_, declared := e.Obj.Decl.(*ast.ValueSpec)
+		return e.Obj.Kind == ast.Var && declared
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		return ok && x.Obj == nil && ast.IsExported(e.Sel.Name) // an imported package's
+	}
+	return false
+}
+
 func parseIfStmt(s *ast.IfStmt, fset *token.FileSet, src []byte) *Branch {
 	lineNo := fset.Position(s.Pos()).Line
 	code := nodeToCode(s, fset, src)
@@ -206,6 +1091,7 @@ func parseIfStmt(s *ast.IfStmt, fset *token.FileSet, src []byte) *Branch {
 				Line:      lineNo,
 				CodeLine:  code,
 				Children:  ExtractBranches(s.Body, fset, src),
+				Init:      stmtCode(s.Init, fset, src),
 				hasReturn: false,
 			},
 		},
@@ -221,6 +1107,7 @@ func parseIfStmt(s *ast.IfStmt, fset *token.FileSet, src []byte) *Branch {
 					Line:      fset.Position(curr.Pos()).Line,
 					CodeLine:  "else " + nodeToCode(curr, fset, src),
 					Children:  ExtractBranches(curr.Body, fset, src),
+					Init:      stmtCode(curr.Init, fset, src),
 					hasReturn: false,
 				})
 
@@ -285,6 +1172,141 @@ func parseRangeStmt(s *ast.RangeStmt, fset *token.FileSet, src []byte) *Branch {
 	}
 }
 
+// markNakedReturns sets the Naked of the bare returns of a function with
+// named results, which return whatever the results hold by then.
+func markNakedReturns(branches []*Branch, results []Field) {
+	names := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.Name == "" {
+			return
+		}
+		names = append(names, r.Name)
+	}
+	if len(names) == 0 {
+		return
+	}
+	for _, b := range flattenBranches(branches) {
+		if b.Type == BranchReturn && strings.TrimSpace(b.CodeLine) == "return" {
+			b.Naked = strings.Join(names, ", ")
+		}
+	}
+}
+
+// markLiteralReturns sets the Returns of the returns whose results are all
+// known before the call: literals, nil, true and false, the package's
+// constants and sentinels as known reports them, and qualified names of
+// imported packages such as io.EOF.
+func markLiteralReturns(body *ast.BlockStmt, branches []*Branch, known func(string) bool, imports map[string]string, fset *token.FileSet) {
+	if body == nil {
+		return
+	}
+	var isLiteral func(ast.Expr) bool
+	isLiteral = func(e ast.Expr) bool {
+		switch e := e.(type) {
+		case *ast.BasicLit:
+			return true
+		case *ast.Ident:
+			return e.Name == "nil" || e.Name == "true" || e.Name == "false" || known(e.Name)
+		case *ast.ParenExpr:
+			return isLiteral(e.X)
+		case *ast.UnaryExpr:
+			return (e.Op == token.SUB || e.Op == token.ADD) && isLiteral(e.X)
+		case *ast.SelectorExpr:
+			x, ok := e.X.(*ast.Ident)
+			return ok && imports[x.Name] != ""
+		}
+		return false
+	}
+
+	byLine := make(map[int]*Branch)
+	for _, b := range flattenBranches(branches) {
+		if b.Type == BranchReturn {
+			byLine[b.Line] = b
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			b := byLine[fset.Position(n.Pos()).Line]
+			if b == nil || len(n.Results) == 0 {
+				return false
+			}
+			results := make([]string, len(n.Results))
+			for i, r := range n.Results {
+				if !isLiteral(r) {
+					return false
+				}
+				results[i] = types.ExprString(r)
+			}
+			b.Returns = results
+		}
+		return true
+	})
+}
+
+// markIntRanges sets the Bound of the range loops over an integer, as in
+// for i := range n, which iterate n times rather than over a collection.
+// Without type information, a range expression counts as an integer when it
+// is a literal, len or cap, a conversion to an integer type, arithmetic on
+// one of them, or a parameter of an integer type.
+func markIntRanges(body *ast.BlockStmt, branches []*Branch, params []Field, fset *token.FileSet) {
+	if body == nil {
+		return
+	}
+	ints := make(map[string]bool)
+	for _, p := range params {
+		if isIntType(p.Type) {
+			ints[p.Name] = true
+		}
+	}
+	var isInt func(ast.Expr) bool
+	isInt = func(e ast.Expr) bool {
+		switch e := e.(type) {
+		case *ast.BasicLit:
+			return e.Kind == token.INT
+		case *ast.Ident:
+			return ints[e.Name]
+		case *ast.ParenExpr:
+			return isInt(e.X)
+		case *ast.CallExpr:
+			fn, ok := e.Fun.(*ast.Ident)
+			return ok && (fn.Name == "len" || fn.Name == "cap" || isIntType(fn.Name))
+		case *ast.BinaryExpr:
+			switch e.Op {
+			case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.SHL, token.SHR:
+				return isInt(e.X) || isInt(e.Y)
+			}
+		}
+		return false
+	}
+
+	byLine := make(map[int]*Branch)
+	for _, b := range flattenBranches(branches) {
+		if b.Type == BranchRange {
+			byLine[b.Line] = b
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if s, ok := n.(*ast.RangeStmt); ok && s.Value == nil && isInt(s.X) {
+			if b := byLine[fset.Position(s.Pos()).Line]; b != nil {
+				b.Bound = types.ExprString(s.X)
+			}
+		}
+		return true
+	})
+}
+
+// isIntType reports whether typ names a predeclared integer type.
+func isIntType(typ string) bool {
+	switch typ {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+		return true
+	}
+	return false
+}
+
 func parseSwitchStmt(s *ast.SwitchStmt, fset *token.FileSet, src []byte) *Branch {
 	lineNo := fset.Position(s.Pos()).Line
 	code := nodeToCode(s, fset, src)
@@ -294,6 +1316,7 @@ func parseSwitchStmt(s *ast.SwitchStmt, fset *token.FileSet, src []byte) *Branch
 		Line:      lineNo,
 		CodeLine:  code,
 		Children:  nil,
+		Init:      stmtCode(s.Init, fset, src),
 		hasReturn: false,
 	}
 
@@ -329,6 +1352,7 @@ func parseTypeSwitchStmt(s *ast.TypeSwitchStmt, fset *token.FileSet, src []byte)
 		Line:      lineNo,
 		CodeLine:  code,
 		Children:  nil,
+		Init:      stmtCode(s.Init, fset, src),
 		hasReturn: false,
 	}
 
@@ -414,6 +1438,16 @@ func extractFromStmtList(stmts []ast.Stmt, fset *token.FileSet, src []byte) []*B
 	return children
 }
 
+// stmtCode returns the source of a statement, or "" for none.
+func stmtCode(stmt ast.Stmt, fset *token.FileSet, src []byte) string {
+	if stmt == nil {
+		return ""
+	}
+	start := fset.Position(stmt.Pos()).Offset
+	end := fset.Position(stmt.End()).Offset
+	return strings.TrimSpace(string(src[start:end]))
+}
+
 func nodeToCode(stmt ast.Stmt, fset *token.FileSet, src []byte) string {
 	switch s := stmt.(type) {
 	case *ast.ReturnStmt:
@@ -440,8 +1474,14 @@ func nodeToCode(stmt ast.Stmt, fset *token.FileSet, src []byte) string {
 		end := fset.Position(s.X.End()).Offset
 		return strings.TrimSpace(string(src[start:end]))
 	case *ast.SwitchStmt:
+		// the tag, the init statement, or neither may be present
 		start := fset.Position(s.Pos()).Offset
-		end := fset.Position(s.Tag.End()).Offset
+		end := start + len("switch")
+		if s.Tag != nil {
+			end = fset.Position(s.Tag.End()).Offset
+		} else if s.Init != nil {
+			end = fset.Position(s.Init.End()).Offset
+		}
 		return strings.TrimSpace(string(src[start:end]))
 	case *ast.TypeSwitchStmt:
 		start := fset.Position(s.Pos()).Offset
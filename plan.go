@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runPlan implements `twintest plan [-format md|csv] [path ...]`, which
+// renders the tests twintest would generate as a plan to review before
+// writing them: per struct, each method, its branches as a tree and the case
+// for each path; or, as CSV, one row per case for a spreadsheet.
+func runPlan(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	format := flags.String("format", "md", "plan format: 'md', or 'csv' for a case matrix")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest plan [-format md|csv] [file.go | dir | dir/...]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "md" && *format != "csv" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	var matrix *csv.Writer
+	if *format == "csv" {
+		matrix = csv.NewWriter(os.Stdout)
+		matrix.Write([]string{"file", "function", "branch", "condition", "path end", "suggested inputs", "expected outcome"})
+	} else {
+		fmt.Fprintln(os.Stdout, "# Test plan")
+	}
+	for _, file := range files {
+		structInfo, _, err := ParseFile(file)
+		if err != nil {
+			return err
+		}
+		sortByPosition(structInfo)
+		if matrix != nil {
+			writeMatrix(matrix, file, structInfo)
+		} else {
+			writePlan(os.Stdout, file, structInfo)
+		}
+	}
+	if matrix != nil {
+		matrix.Flush()
+		return matrix.Error()
+	}
+	return nil
+}
+
+// writePlan renders the plan for the structs and functions of one file.
+func writePlan(w io.Writer, file string, structInfo []*StructInfo) {
+	fmt.Fprintf(w, "\n## %s\n", file)
+	for _, si := range structInfo {
+		if si.IsInterface || len(si.Methods) == 0 {
+			continue
+		}
+		switch {
+		case si.Name == "":
+			fmt.Fprintf(w, "\n### Functions\n")
+		default:
+			fmt.Fprintf(w, "\n### %s\n", si.Name)
+		}
+		for _, fn := range si.Methods {
+			fmt.Fprintf(w, "\n#### `%s` (line %d)\n\n", signature(fn), fn.Line)
+			if len(fn.Branches) == 0 {
+				fmt.Fprintln(w, "- [ ] a single path: call it and assert its results")
+				continue
+			}
+			for _, b := range fn.Branches {
+				writePlanBranch(w, b, 0)
+			}
+		}
+	}
+}
+
+// writePlanBranch renders b and its children as a nested task list; the
+// paths out of the function carry the case that covers them.
+func writePlanBranch(w io.Writer, b *Branch, depth int) {
+	indent := strings.Repeat("  ", depth)
+	fmt.Fprintf(w, "%s- [ ] `%s` (line %d)", indent, strings.Join(strings.Fields(b.CodeLine), " "), b.Line)
+	if c := planCase(b); c != "" {
+		fmt.Fprintf(w, ": %s", c)
+	}
+	fmt.Fprintln(w)
+	for _, child := range b.Children {
+		writePlanBranch(w, child, depth+1)
+	}
+}
+
+// planCase describes the case intended for a branch, or "" for one that
+// only leads to others.
+func planCase(b *Branch) string {
+	var arrange string
+	if b.Init != "" {
+		arrange = fmt.Sprintf("arrange `%s`, then ", b.Init)
+	}
+	switch {
+	case b.Dead != "":
+		return "unreachable, " + b.Dead
+	case len(b.Children) > 0:
+		if arrange != "" {
+			return strings.TrimSuffix(arrange, ", then ")
+		}
+		return boundCase(b)
+	case b.Bound != "":
+		return arrange + boundCase(b)
+	case b.Type == BranchPanic:
+		return arrange + fmt.Sprintf("assert it panics with `%s`", b.Panic)
+	case len(b.Wraps) > 0:
+		return arrange + fmt.Sprintf("assert the error wraps `%s`", strings.Join(b.Wraps, "`, `"))
+	case b.Naked != "":
+		return arrange + fmt.Sprintf("reach this bare return and assert `%s` as set by then", b.Naked)
+	case b.Type == BranchReturn:
+		return arrange + "reach this return and assert its results"
+	case b.Type == BranchBreak || b.Type == BranchContinue || b.Type == BranchFallthrough:
+		return arrange + "reach this exit and assert the results that follow"
+	}
+	return arrange + "reach this branch and assert its effects"
+}
+
+// boundCase suggests the iteration counts to try an integer range loop
+// with, or "" for other branches.
+func boundCase(b *Branch) string {
+	switch {
+	case b.Bound == "":
+		return ""
+	case b.BoundHint() == "":
+		return fmt.Sprintf("it runs %s times; assert its effects", b.Bound)
+	}
+	return fmt.Sprintf("run it with `%[1]s` = 0, 1 and a large `%[1]s`", b.Bound)
+}
+
+// signature spells fn's declaration, such as `(*T).Get(key string) (int, error)`.
+func signature(fn FuncInfo) string {
+	var b strings.Builder
+	if fn.Receiver != "" {
+		recv := fn.Receiver
+		if fn.PtrRecv {
+			recv = "*" + recv
+		}
+		fmt.Fprintf(&b, "(%s).", recv)
+	}
+	b.WriteString(fn.Name)
+	b.WriteString("(" + fieldList(fn.Params) + ")")
+	switch {
+	case len(fn.Results) == 1 && fn.Results[0].Name == "":
+		b.WriteString(" " + fn.Results[0].Type)
+	case len(fn.Results) > 0:
+		b.WriteString(" (" + fieldList(fn.Results) + ")")
+	}
+	return b.String()
+}
+
+// fieldList spells a parameter or result list.
+func fieldList(fields []Field) string {
+	list := make([]string, len(fields))
+	for i, f := range fields {
+		list[i] = strings.TrimSpace(f.Name + " " + f.Type)
+	}
+	return strings.Join(list, ", ")
+}
+
+// writeMatrix writes a row for each path through the functions of one file:
+// the conditions leading to it, the inputs they suggest and an outcome for
+// stakeholders to fill in.
+func writeMatrix(w *csv.Writer, file string, structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if si.IsInterface {
+			continue
+		}
+		for _, fn := range si.Methods {
+			name := fn.Name
+			if fn.Receiver != "" {
+				name = fn.Receiver + "." + fn.Name
+			}
+			params := make(map[string]bool)
+			for _, p := range fn.Params {
+				params[p.Name] = true
+			}
+			if len(fn.Branches) == 0 {
+				w.Write([]string{file, name, strconv.Itoa(fn.Line), "", "", "", "TBD"})
+				continue
+			}
+			for _, path := range leafPaths(fn.Branches) {
+				leaf := path[len(path)-1]
+				conds := make([]string, 0, len(path))
+				var inputs []string
+				for _, b := range path {
+					if b.Type == BranchReturn || b.Type == BranchPanic || b.Type == BranchIfHost {
+						continue
+					}
+					conds = append(conds, b.Name())
+					inputs = append(inputs, suggestInputs(b, params, fn.Operands)...)
+					if b != leaf && params[b.Bound] {
+						// a path into the loop body takes an iteration
+						inputs = append(inputs, b.Bound+" = 1")
+					}
+				}
+				w.Write([]string{
+					file, name, strconv.Itoa(leaf.Line),
+					strings.Join(conds, " && "),
+					strings.Join(strings.Fields(leaf.CodeLine), " "),
+					strings.Join(uniqueSorted(inputs), "; "),
+					"TBD",
+				})
+			}
+		}
+	}
+}
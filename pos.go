@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parsePos splits a -pos argument, "file.go:123" for a line or
+// "file.go:#456" for a byte offset, into the file and the line it points at.
+func parsePos(pos string) (file string, line int, err error) {
+	i := strings.LastIndexByte(pos, ':')
+	if i < 0 {
+		return "", 0, fmt.Errorf("-pos %q: want file.go:line or file.go:#offset", pos)
+	}
+	file, at := pos[:i], pos[i+1:]
+
+	offset, isOffset := strings.CutPrefix(at, "#")
+	n, err := strconv.Atoi(offset)
+	if err != nil || n < 0 {
+		return "", 0, fmt.Errorf("-pos %q: want file.go:line or file.go:#offset", pos)
+	}
+	if !isOffset {
+		return file, n, nil
+	}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return "", 0, err
+	}
+	if n > len(src) {
+		return "", 0, fmt.Errorf("-pos %q: offset past the end of the file", pos)
+	}
+	return file, bytes.Count(src[:n], []byte("\n")) + 1, nil
+}
+
+// trimToLine keeps only the function or method declared around line, so
+// that it alone is generated and spliced into the existing test file. It is
+// an error if there is none.
+func trimToLine(structInfo []*StructInfo, line int) ([]*StructInfo, error) {
+	for _, si := range structInfo {
+		if si.IsInterface {
+			continue
+		}
+		for _, fn := range si.Methods {
+			if fn.Line <= line && line <= fn.EndLine {
+				si.Methods = []FuncInfo{fn}
+				si.Partial = true
+				return []*StructInfo{si}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no function or method encloses line %d", line)
+}
+
+// spliceTest updates the test file old with the single test function that
+// generated holds: an existing test of the same name and receiver is
+// replaced, otherwise the test is appended. Imports the test needs are added.
+func spliceTest(old, generated []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	oldFile, err := parser.ParseFile(fset, "old.go", old, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	newFile, err := parser.ParseFile(fset, "new.go", generated, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var test *ast.FuncDecl
+	for _, decl := range newFile.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(fn.Name.Name, "Test_") {
+			test = fn
+		}
+	}
+	if test == nil {
+		return old, nil
+	}
+	start, end := declRange(fset, test)
+	testText := generated[start:end]
+
+	var out []byte
+	replaced := false
+	for _, decl := range oldFile.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && sameTest(fn, test, old, generated, fset) {
+			start, end := declRange(fset, fn)
+			out = append(append(append(out, old[:start]...), testText...), old[end:]...)
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		out = append(append(bytes.TrimRight(old, "\n"), "\n\n"...), testText...)
+		out = append(out, '\n')
+	}
+
+	out = addImports(out, oldFile, newFile)
+	if formatted, err := format.Source(out); err == nil {
+		out = formatted
+	}
+	return out, nil
+}
+
+// declRange returns the byte offsets of fn, doc comment included.
+func declRange(fset *token.FileSet, fn *ast.FuncDecl) (start, end int) {
+	pos := fn.Pos()
+	if fn.Doc != nil {
+		pos = fn.Doc.Pos()
+	}
+	return fset.Position(pos).Offset, fset.Position(fn.End()).Offset
+}
+
+// sameTest reports whether two test functions have the same name and
+// receiver type.
+func sameTest(a, b *ast.FuncDecl, srcA, srcB []byte, fset *token.FileSet) bool {
+	if a.Name.Name != b.Name.Name || (a.Recv == nil) != (b.Recv == nil) {
+		return false
+	}
+	if a.Recv == nil {
+		return true
+	}
+	typeText := func(fn *ast.FuncDecl, src []byte) string {
+		t := fn.Recv.List[0].Type
+		return string(src[fset.Position(t.Pos()).Offset:fset.Position(t.End()).Offset])
+	}
+	return typeText(a, srcA) == typeText(b, srcB)
+}
+
+// addImports inserts the imports of newFile that oldFile lacks into src,
+// the text of oldFile after splicing, which starts the same way.
+func addImports(src []byte, oldFile, newFile *ast.File) []byte {
+	have := make(map[string]bool)
+	for _, imp := range oldFile.Imports {
+		have[imp.Path.Value] = true
+	}
+	var missing []string
+	for _, imp := range newFile.Imports {
+		if have[imp.Path.Value] {
+			continue
+		}
+		spec := imp.Path.Value
+		if imp.Name != nil {
+			spec = imp.Name.Name + " " + spec
+		}
+		missing = append(missing, "\t"+spec+"\n")
+	}
+	if len(missing) == 0 {
+		return src
+	}
+
+	block := []byte("import (\n")
+	i := bytes.Index(src, block)
+	if i < 0 {
+		return src
+	}
+	i += len(block)
+	return append(append([]byte(nil), src[:i]...), append([]byte(strings.Join(missing, "")), src[i:]...)...)
+}
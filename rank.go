@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Ranking is a function's place in `twintest rank`: the branches no test
+// reaches yet, weighted by how deeply they nest and whether it is exported.
+type Ranking struct {
+	File     string
+	Name     string // Receiver.Method or Func
+	Line     int
+	Exported bool
+	Branches int
+	Untested int // branches not reached by the coverage profile, or all of them
+	Depth    int
+	Score    float64
+}
+
+// runRank implements `twintest rank [-cover profile] [-top n] [path ...]`,
+// listing functions by the payoff of generating tests for them.
+func runRank(args []string) error {
+	flags := flag.NewFlagSet("rank", flag.ExitOnError)
+	cover := flags.String("cover", "", "coverage profile from go test -coverprofile; branches it reached do not count")
+	top := flags.Int("top", 20, "list at most this many functions; 0 for all")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest rank [-cover profile] [-top n] [file.go | dir | dir/...]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	var profile coverProfile
+	if *cover != "" {
+		if profile, err = readCoverProfile(*cover); err != nil {
+			return err
+		}
+	}
+
+	var rankings []Ranking
+	for _, file := range files {
+		structInfo, _, err := ParseFile(file)
+		if err != nil {
+			return err
+		}
+		blocks := profile.blocksFor(file)
+		for _, si := range structInfo {
+			if si.IsInterface {
+				continue
+			}
+			for _, fn := range si.Methods {
+				if r := rank(file, fn, blocks, profile != nil); r.Branches > 0 {
+					rankings = append(rankings, r)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(rankings, func(i, j int) bool {
+		return rankings[i].Score > rankings[j].Score
+	})
+	if *top > 0 && len(rankings) > *top {
+		rankings = rankings[:*top]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tUNTESTED\tBRANCHES\tDEPTH\tFUNCTION\tPOSITION")
+	for _, r := range rankings {
+		fmt.Fprintf(w, "%.1f\t%d\t%d\t%d\t%s\t%s:%d\n", r.Score, r.Untested, r.Branches, r.Depth, r.Name, r.File, r.Line)
+	}
+	return w.Flush()
+}
+
+// rank scores fn. Without a coverage profile every branch counts as untested.
+func rank(file string, fn FuncInfo, blocks []coverBlock, covered bool) Ranking {
+	r := Ranking{
+		File:     file,
+		Name:     fn.Name,
+		Line:     fn.Line,
+		Exported: fn.IsExported,
+		Branches: countBranches(fn.Branches),
+		Depth:    branchDepth(fn.Branches),
+	}
+	if fn.Receiver != "" {
+		r.Name = fn.Receiver + "." + fn.Name
+	}
+	for _, b := range flattenBranches(fn.Branches) {
+		if !covered || !reached(blocks, b.Line) {
+			r.Untested++
+		}
+	}
+
+	// nested branches are the ones hand-written tests tend to miss, and
+	// exported functions are the ones callers depend on
+	r.Score = float64(r.Untested) * (1 + float64(r.Depth)/2)
+	if r.Exported {
+		r.Score *= 1.5
+	}
+	return r
+}
+
+// coverBlock is a block of statements in a coverage profile.
+type coverBlock struct {
+	StartLine, StartCol int
+	EndLine             int
+	Count               int
+}
+
+// coverProfile holds the blocks of a coverage profile by file, as named in
+// the profile: import path and file name.
+type coverProfile map[string][]coverBlock
+
+// readCoverProfile reads a profile written by go test -coverprofile.
+func readCoverProfile(path string) (coverProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	profile := make(coverProfile)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name.go:startLine.startCol,endLine.endCol numStmts count
+		line := scanner.Text()
+		if strings.HasPrefix(line, "mode:") || line == "" {
+			continue
+		}
+		colon := strings.LastIndexByte(line, ':')
+		fields := strings.Fields(line[colon+1:])
+		if colon < 0 || len(fields) != 3 {
+			return nil, fmt.Errorf("%s: malformed line %q", path, line)
+		}
+		span := strings.Split(fields[0], ",")
+		count, err := strconv.Atoi(fields[2])
+		if len(span) != 2 || err != nil {
+			return nil, fmt.Errorf("%s: malformed line %q", path, line)
+		}
+		start, col, _ := strings.Cut(span[0], ".")
+		startLine, _ := strconv.Atoi(start)
+		startCol, _ := strconv.Atoi(col)
+		end, _ := strconv.Atoi(strings.Split(span[1], ".")[0])
+		name := line[:colon]
+		profile[name] = append(profile[name], coverBlock{StartLine: startLine, StartCol: startCol, EndLine: end, Count: count})
+	}
+	return profile, scanner.Err()
+}
+
+// blocksFor finds the blocks of a source file, whose profile name is its
+// import path: the longest profile name that the file's path ends with.
+func (p coverProfile) blocksFor(file string) []coverBlock {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil
+	}
+	abs = filepath.ToSlash(abs)
+	best := ""
+	for name := range p {
+		if (abs == name || strings.HasSuffix(abs, "/"+name) || strings.HasSuffix(name, "/"+relToModule(abs))) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return p[best]
+}
+
+// relToModule returns abs relative to the root of its module, or its last
+// two elements when it is in none.
+func relToModule(abs string) string {
+	for dir := filepath.Dir(abs); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			rel, _ := filepath.Rel(dir, abs)
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(filepath.Dir(abs)) + "/" + filepath.Base(abs)
+}
+
+// reached reports whether a block covering line ran.
+func reached(blocks []coverBlock, line int) bool {
+	for _, b := range blocks {
+		if b.StartLine <= line && line <= b.EndLine && b.Count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceFiles expands paths, each a Go file, a directory, or a tree when it
+// ends in "/...", into the non-test Go files they name. Directories are
+// expanded as .twintestignore directs; files named outright are always kept.
+func sourceFiles(paths []string) ([]string, error) {
+	var files []string
+	isSource := func(name string) bool {
+		return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go")
+	}
+	for _, path := range paths {
+		if root, ok := strings.CutSuffix(path, "/..."); ok {
+			rules, err := loadIgnore(root)
+			if err != nil {
+				return nil, err
+			}
+			unused, err := workspaceFilter(root)
+			if err != nil {
+				return nil, err
+			}
+			err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() && p != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "vendor" || d.Name() == "testdata" || rules.ignored(p, true) || unused(p)) {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() && isSource(d.Name()) && !rules.ignored(p, false) {
+					files = append(files, p)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		rules, err := loadIgnore(path)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			file := filepath.Join(path, e.Name())
+			if !e.IsDir() && isSource(e.Name()) && !rules.ignored(file, false) {
+				files = append(files, file)
+			}
+		}
+	}
+	return files, nil
+}
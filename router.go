@@ -0,0 +1,111 @@
+package main
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// Handler is a function serving requests in the idiom of a router, which
+// its test calls with a request recorded through httptest.
+type Handler struct {
+	Router string   // "gin", "echo", "chi", or "http" for a plain net/http handler
+	Pkg    string   // local name of the router package in the source, "" for "http"
+	Params []string // path parameters it reads, e.g. "id" for c.Param("id")
+}
+
+// routerPackages are the import paths of the routers, by the name of their
+// package.
+var routerPackages = map[string][]string{
+	"gin":  {"github.com/gin-gonic/gin"},
+	"echo": {"github.com/labstack/echo/v4", "github.com/labstack/echo"},
+	"chi":  {"github.com/go-chi/chi/v5", "github.com/go-chi/chi"},
+}
+
+// routerOf returns which router a package imported as path is, or "".
+func routerOf(path string) string {
+	for router, paths := range routerPackages {
+		for _, p := range paths {
+			if p == path {
+				return router
+			}
+		}
+	}
+	return ""
+}
+
+// detectHandler returns the handler fn is by its signature, or nil: a
+// gin.HandlerFunc, func(*gin.Context); an echo.HandlerFunc,
+// func(echo.Context) error; or a net/http handler, which is a chi one when
+// it reads path parameters through chi.URLParam.
+func detectHandler(fn *ast.FuncDecl, params, results []Field, imports map[string]string) *Handler {
+	if fn.Body == nil {
+		return nil
+	}
+	var h *Handler
+	switch {
+	case len(params) == 1 && len(results) == 0 && strings.HasPrefix(params[0].Type, "*") &&
+		routerOf(typePackage(params[0].Type, imports)) == "gin" && strings.HasSuffix(params[0].Type, ".Context"):
+		h = &Handler{Router: "gin"}
+	case len(params) == 1 && len(results) == 1 && isErrorType(results[0].Type) &&
+		routerOf(typePackage(params[0].Type, imports)) == "echo" && strings.HasSuffix(params[0].Type, ".Context"):
+		h = &Handler{Router: "echo"}
+	case len(params) == 2 && len(results) == 0 &&
+		typePackage(params[0].Type, imports) == "net/http" && strings.HasSuffix(params[0].Type, ".ResponseWriter") &&
+		typePackage(params[1].Type, imports) == "net/http" && strings.HasSuffix(params[1].Type, ".Request"):
+		h = &Handler{Router: "http"}
+	default:
+		return nil
+	}
+	if h.Router != "http" {
+		h.Pkg = strings.TrimLeft(params[0].Type, "*")
+		h.Pkg = h.Pkg[:strings.Index(h.Pkg, ".")]
+	}
+
+	seen := make(map[string]bool)
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		name := call.Args[len(call.Args)-1]
+		switch {
+		case h.Router == "gin" || h.Router == "echo":
+			// c.Param("id") on the handler's context
+			if x.Name != params[0].Name || sel.Sel.Name != "Param" || len(call.Args) != 1 {
+				return true
+			}
+		case sel.Sel.Name == "URLParam" && routerOf(imports[x.Name]) == "chi" && len(call.Args) == 2:
+			h.Router, h.Pkg = "chi", x.Name
+		default:
+			return true
+		}
+		lit, ok := name.(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+		if param, err := strconv.Unquote(lit.Value); err == nil && !seen[param] {
+			seen[param] = true
+			h.Params = append(h.Params, param)
+		}
+		return true
+	})
+	return h
+}
+
+// ParamNames quotes the path parameters of h as Go string literals.
+func (h *Handler) ParamNames() []string {
+	names := make([]string, len(h.Params))
+	for i, p := range h.Params {
+		names[i] = strconv.Quote(p)
+	}
+	return names
+}
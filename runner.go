@@ -0,0 +1,148 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runnerFile runs the suites of a package with -runner.
+const runnerFile = "twintest_suites_test.go"
+
+// runnerSuites lists the suites the runner file of dir registers: those of
+// ss, and those of the generated files already in dir, from earlier runs
+// for other source files, that have no test of their own to run them. Generic
+// suites always run their own instances.
+func runnerSuites(dir string, ss []*StructInfo) ([]string, error) {
+	names := make(map[string]bool)
+	for _, si := range ss {
+		if si.Name != "" && !si.IsInterface && si.TypeParams == "" && !si.BlackBox {
+			names[si.Name] = true
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		file := filepath.Join(dir, e.Name())
+		// suites placed by //twintest:file can be in any generated test file
+		if e.IsDir() || !strings.HasSuffix(e.Name(), "_test.go") || e.Name() == runnerFile || !isGenerated(file) {
+			continue
+		}
+		for _, name := range unrunSuites(file) {
+			names[name] = true
+		}
+	}
+
+	suites := make([]string, 0, len(names))
+	for name := range names {
+		suites = append(suites, name)
+	}
+	sort.Strings(suites)
+	return suites, nil
+}
+
+// unrunSuites lists the non-generic XTestSuite types declared in a generated
+// suite file whose TestXTestSuite function it lacks, by the names of the
+// structs they test. A file that does not parse yields none.
+func unrunSuites(file string) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	declared := make(map[string]bool)
+	var suites []string
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				declared[d.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.TypeParams != nil {
+					continue
+				}
+				if name, ok := strings.CutSuffix(ts.Name.Name, "TestSuite"); ok && name != "" {
+					suites = append(suites, name)
+				}
+			}
+		}
+	}
+
+	unrun := suites[:0]
+	for _, name := range suites {
+		if !declared["Test"+upperFirst(name)+"TestSuite"] {
+			unrun = append(unrun, name)
+		}
+	}
+	return unrun
+}
+
+// BaseSuite is a suite type the test package declares for its suites to
+// share setup, such as containers or tracing, by embedding it.
+type BaseSuite struct {
+	Name    string
+	Methods map[string]bool // its lifecycle methods, which the generated ones call
+}
+
+// findBaseSuite looks for the -base-suite struct among the hand-written
+// test files of pkgName in dir, or returns nil.
+func findBaseSuite(dir, pkgName string) (*BaseSuite, error) {
+	if *baseSuite == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var base *BaseSuite
+	methods := make(map[string]bool)
+	for _, e := range entries {
+		file := filepath.Join(dir, e.Name())
+		if e.IsDir() || !strings.HasSuffix(e.Name(), "_test.go") || isGenerated(file) {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == *baseSuite && ts.TypeParams == nil {
+						if _, ok := ts.Type.(*ast.StructType); ok {
+							base = &BaseSuite{Name: ts.Name.Name, Methods: methods}
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if GetReceiverType(d) == *baseSuite {
+					methods[d.Name.Name] = true
+				}
+			}
+		}
+	}
+	return base, nil
+}
+
+// BaseCall renders the call of a generated lifecycle method to the one of
+// the base suite it shadows, or "" when the base suite has no such method.
+func (si *StructInfo) BaseCall(method string) string {
+	if si.Base == nil || !si.Base.Methods[method] {
+		return ""
+	}
+	args := ""
+	if method == "BeforeTest" || method == "AfterTest" {
+		args = "suiteName, testName"
+	}
+	return "suite." + si.Base.Name + "." + method + "(" + args + ")"
+}
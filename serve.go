@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes used by serve.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// fileParams are the parameters of the analyze and generate methods. A
+// line limits generate to the function around it.
+type fileParams struct {
+	File string `json:"file"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Analysis describes the testable code of a source file.
+type Analysis struct {
+	Package string         `json:"package"`
+	Types   []TypeAnalysis `json:"types"`
+}
+
+// TypeAnalysis describes a struct or interface, or with an empty name the
+// package-level functions.
+type TypeAnalysis struct {
+	Name      string         `json:"name"`
+	Kind      string         `json:"kind"` // "func", "struct" or "interface"
+	Line      int            `json:"line,omitempty"`
+	Functions []FuncAnalysis `json:"functions"`
+}
+
+// FuncAnalysis describes a function or method.
+type FuncAnalysis struct {
+	Name     string `json:"name"`
+	Line     int    `json:"line"`
+	Exported bool   `json:"exported"`
+	Branches int    `json:"branches"`
+}
+
+// server answers requests, remembering the parse of each file until it
+// changes.
+type server struct {
+	analyses map[string]cachedAnalysis
+}
+
+type cachedAnalysis struct {
+	modTime     time.Time
+	analysis    *Analysis
+	structInfo  []*StructInfo // as parsed, before generate trims it
+	packageName string
+}
+
+// serve reads JSON-RPC 2.0 requests from in and writes the responses to out,
+// one JSON value each, until in ends or an "exit" request arrives. It offers
+// "analyze" and "generate", both taking {"file": "path/to/file.go"}; generate
+// also takes a "line" to target the function under the cursor.
+func serve(in io.Reader, out io.Writer) error {
+	s := &server{analyses: make(map[string]cachedAnalysis)}
+	dec := json.NewDecoder(in)
+	enc := json.NewEncoder(out)
+	for {
+		var req rpcRequest
+		if err := dec.Decode(&req); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			// the stream cannot be resynchronised after malformed JSON
+			enc.Encode(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+				Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			return err
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(req)
+		if req.ID == nil {
+			continue // a notification
+		}
+		resp := rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(req rpcRequest) (any, *rpcError) {
+	var params fileParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+
+	switch req.Method {
+	case "analyze", "generate":
+		if params.File == "" {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "params.file is required"}
+		}
+	default:
+		return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+	}
+
+	var result any
+	var err error
+	if req.Method == "analyze" {
+		result, err = s.analyze(params.File)
+	} else {
+		var files []string
+		files, err = s.generate(params.File, params.Line)
+		result = map[string][]string{"files": files}
+	}
+	if err != nil {
+		return nil, &rpcError{Code: rpcServerError, Message: err.Error()}
+	}
+	return result, nil
+}
+
+// analyze describes the testable code of file.
+func (s *server) analyze(file string) (*Analysis, error) {
+	c, err := s.parse(file)
+	if err != nil {
+		return nil, err
+	}
+	return c.analysis, nil
+}
+
+// generate is run for file, from a copy of its cached parse.
+func (s *server) generate(file string, line int) ([]string, error) {
+	var err error
+	if config, err = loadConfig(filepath.Dir(file)); err != nil {
+		return nil, err
+	}
+	c, err := s.parse(file)
+	if err != nil {
+		return nil, err
+	}
+	return generateParsed(file, line, clone(c.structInfo), c.packageName)
+}
+
+// parse parses file, or reuses the parse from an earlier request if the file
+// has not changed since.
+func (s *server) parse(file string) (cachedAnalysis, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return cachedAnalysis{}, err
+	}
+	if c, ok := s.analyses[file]; ok && c.modTime.Equal(info.ModTime()) {
+		return c, nil
+	}
+
+	structInfo, packageName, err := ParseFile(file)
+	if err != nil {
+		return cachedAnalysis{}, err
+	}
+	parsed := clone(structInfo)
+	sortByPosition(structInfo)
+
+	analysis := &Analysis{Package: packageName, Types: []TypeAnalysis{}}
+	for _, si := range structInfo {
+		if si.Name == "" && len(si.Methods) == 0 {
+			continue
+		}
+		t := TypeAnalysis{Name: si.Name, Kind: "struct", Line: si.Line, Functions: []FuncAnalysis{}}
+		switch {
+		case si.Name == "":
+			t.Kind = "func"
+		case si.IsInterface:
+			t.Kind = "interface"
+		}
+		for _, fn := range si.Methods {
+			t.Functions = append(t.Functions, FuncAnalysis{
+				Name:     fn.Name,
+				Line:     fn.Line,
+				Exported: fn.IsExported,
+				Branches: countBranches(fn.Branches),
+			})
+		}
+		analysis.Types = append(analysis.Types, t)
+	}
+
+	c := cachedAnalysis{modTime: info.ModTime(), analysis: analysis, structInfo: parsed, packageName: packageName}
+	s.analyses[file] = c
+	return c, nil
+}
+
+// clone returns a deep copy of v, through pointers, slices and maps, for
+// generate to trim and annotate without touching the cached parse.
+// Unexported fields, which generating only reads, are shared.
+func clone[T any](v T) T {
+	var dst T
+	deepCopy(reflect.ValueOf(&dst).Elem(), reflect.ValueOf(v))
+	return dst
+}
+
+func deepCopy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if !src.IsNil() {
+			dst.Set(reflect.New(src.Type().Elem()))
+			deepCopy(dst.Elem(), src.Elem())
+		}
+	case reflect.Slice:
+		if !src.IsNil() {
+			dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+			for i := range src.Len() {
+				deepCopy(dst.Index(i), src.Index(i))
+			}
+		}
+	case reflect.Map:
+		if !src.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+			for iter := src.MapRange(); iter.Next(); {
+				v := reflect.New(src.Type().Elem()).Elem()
+				deepCopy(v, iter.Value())
+				dst.SetMapIndex(iter.Key(), v)
+			}
+		}
+	case reflect.Struct:
+		dst.Set(src)
+		for i := range src.NumField() {
+			if dst.Field(i).CanSet() {
+				deepCopy(dst.Field(i), src.Field(i))
+			}
+		}
+	default:
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// shardPattern matches the files a sharded suite is split into, such as
+// foo_bar_suite_b_test.go, capturing the part naming the struct.
+var shardPattern = regexp.MustCompile(`^(.*)_suite_([a-z]+)_test\.go$`)
+
+// sharded reports whether the suite of si is split across files by -shard.
+// A suite updated in place by -pos is not, as its method is spliced into
+// the one file.
+func sharded(si *StructInfo) bool {
+	return *shard > 0 && si.Name != "" && !si.IsInterface && !si.Partial && len(si.Methods) > *shard
+}
+
+// shardSuffix names the i-th file of a sharded suite: a to z, then aa, ab...
+func shardSuffix(i int) string {
+	if i < 26 {
+		return string(rune('a' + i))
+	}
+	return shardSuffix(i/26-1) + shardSuffix(i%26)
+}
+
+// shardFile returns the name of the i-th file of the suite otherwise
+// generated into filename.
+func shardFile(filename string, i int) string {
+	return strings.TrimSuffix(filename, "_test.go") + "_" + shardSuffix(i) + "_test.go"
+}
+
+// generateShards renders the suite of si as GenerateTestFile would, then
+// moves its test methods into files of at most -shard methods each, keeping
+// methods of the same name prefix, such as Get or List, together. The first
+// file keeps the suite type, its lifecycle and helpers.
+func generateShards(filename string, si *StructInfo, packageName string, banner []byte, report func(string, bool)) error {
+	code, err := renderTestFile(filename, si, packageName)
+	if err != nil {
+		return err
+	}
+	parts, err := splitSuite(code, *shard)
+	if err != nil {
+		return err
+	}
+	for i, part := range parts {
+		name := shardFile(filename, i)
+		content, err := postProcess(name, append(append([]byte(nil), banner...), part...))
+		if err != nil {
+			return err
+		}
+		written, err := writeGenerated(name, content)
+		if err != nil {
+			return err
+		}
+		report(name, written)
+	}
+	return removeStaleShards(filename, len(parts))
+}
+
+// removeStaleShards deletes the generated files of an earlier split of the
+// suite of filename beyond the first keep, and the unsplit file when keep is
+// not zero, so no test method is declared twice.
+func removeStaleShards(filename string, keep int) error {
+	if *output != "files" {
+		return nil
+	}
+	stale := []string{}
+	if keep > 0 {
+		stale = append(stale, filename)
+	}
+	matches, err := filepath.Glob(strings.TrimSuffix(filename, "_test.go") + "_*_test.go")
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(filepath.Base(filename), "_test.go") + "_"
+	for _, file := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), prefix), "_test.go")
+		if index := shardIndex(suffix); index >= keep {
+			stale = append(stale, file)
+		}
+	}
+	for _, file := range stale {
+		if !isGenerated(file) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		os.Remove(basePath(file))
+		logEvent(status, eventPruned, "Pruned "+file, "file", file)
+	}
+	return nil
+}
+
+// shardIndex is the inverse of shardSuffix, or -1 for a suffix it never
+// returns.
+func shardIndex(suffix string) int {
+	if suffix == "" {
+		return -1
+	}
+	index := 0
+	for _, r := range suffix {
+		if r < 'a' || r > 'z' {
+			return -1
+		}
+		index = index*26 + int(r-'a') + 1
+	}
+	return index - 1
+}
+
+// splitSuite splits a rendered suite file into files of at most n test
+// methods each, every one with the imports it uses.
+func splitSuite(code []byte, n int) ([][]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", code, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	// the test methods, in groups sharing a name prefix
+	var order []string
+	groups := make(map[string][]*ast.FuncDecl)
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || !strings.HasPrefix(fn.Name.Name, "Test") {
+			continue
+		}
+		key := namePrefix(strings.TrimPrefix(strings.TrimPrefix(fn.Name.Name, "Test"), "_"))
+		if groups[key] == nil {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], fn)
+	}
+
+	var shards [][]*ast.FuncDecl
+	var current []*ast.FuncDecl
+	for _, key := range order {
+		group := groups[key]
+		if len(current) > 0 && len(current)+len(group) > n {
+			shards = append(shards, current)
+			current = nil
+		}
+		for len(group) > n {
+			shards = append(shards, group[:n])
+			group = group[n:]
+		}
+		current = append(current, group...)
+	}
+	if len(current) > 0 || len(shards) == 0 {
+		shards = append(shards, current)
+	}
+
+	span := func(fn *ast.FuncDecl) (int, int) {
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		return fset.Position(start).Offset, fset.Position(fn.End()).Offset
+	}
+
+	// the head every file starts with: the package clause and the imports
+	head := fset.Position(f.Name.End()).Offset
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			head = fset.Position(gen.End()).Offset
+		}
+	}
+
+	// the first file is the rendered one without the methods moved out
+	moved := make(map[*ast.FuncDecl]bool)
+	for _, fns := range shards[1:] {
+		for _, fn := range fns {
+			moved[fn] = true
+		}
+	}
+	var first bytes.Buffer
+	last := 0
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && moved[fn] {
+			start, end := span(fn)
+			first.Write(code[last:start])
+			last = end
+		}
+	}
+	first.Write(code[last:])
+
+	parts := [][]byte{first.Bytes()}
+	for _, fns := range shards[1:] {
+		var buf bytes.Buffer
+		buf.Write(code[:head])
+		for _, fn := range fns {
+			start, end := span(fn)
+			buf.WriteString("\n\n")
+			buf.Write(code[start:end])
+		}
+		buf.WriteString("\n")
+		parts = append(parts, buf.Bytes())
+	}
+
+	for i, part := range parts {
+		part = dropUnusedImports(part)
+		if formatted, err := format.Source(part); err == nil {
+			part = formatted
+		}
+		parts[i] = part
+	}
+	return parts, nil
+}
+
+// namePrefix returns the first word of a camel-case name, such as Get for
+// GetUser.
+func namePrefix(name string) string {
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// dropUnusedImports removes the imports code does not refer to, judging the
+// package name of an unnamed import by its path.
+func dropUnusedImports(code []byte) []byte {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", code, parser.ParseComments)
+	if err != nil {
+		return code
+	}
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			// a local such as the suite receiver resolves; a package does not
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+
+	var out bytes.Buffer
+	last := 0
+	for _, spec := range f.Imports {
+		name := importName(spec)
+		if name == "_" || name == "." || used[name] {
+			continue
+		}
+		start := fset.Position(spec.Pos()).Offset
+		end := fset.Position(spec.End()).Offset
+		// the whole line, when the import has one of its own
+		if i := bytes.LastIndexByte(code[:start], '\n'); i >= 0 && len(bytes.TrimSpace(code[i+1:start])) == 0 {
+			start = i
+		}
+		out.Write(code[last:start])
+		last = end
+	}
+	out.Write(code[last:])
+	return out.Bytes()
+}
+
+// importName is the name an import declares: its explicit name, or else the
+// pathName of its path.
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return ""
+	}
+	return pathName(path)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SQLQuery is a statement a method runs through database/sql, as a string
+// literal in its body, which seeds the sqlmock expectation of its leaves.
+type SQLQuery struct {
+	SQL     string   // the statement, quoted as a Go string
+	Kind    string   // "Query", "Exec" or "Prepare", after the sqlmock expectation it needs
+	Columns []string // columns a SELECT returns, quoted, when it lists them plainly
+}
+
+// sqlCalls maps the database/sql methods taking a statement to the kind of
+// expectation sqlmock sets for them.
+var sqlCalls = map[string]string{
+	"Query": "Query", "QueryContext": "Query", "QueryRow": "Query", "QueryRowContext": "Query",
+	"Exec": "Exec", "ExecContext": "Exec",
+	"Prepare": "Prepare", "PrepareContext": "Prepare",
+}
+
+// sqlStatement matches the text of a string literal that looks like SQL.
+var sqlStatement = regexp.MustCompile(`(?is)^(SELECT\s|select\s.+\sfrom\s|insert\s+into\s|update\s+\S+\s+set\s|delete\s+from\s|with\s+\S+\s+as\s*\(|replace\s+into\s)`)
+
+// collectQueries lists, in order of appearance, the SQL statements in body:
+// literals passed to Query, Exec, Prepare and their variants, and any other
+// literal that looks like SQL, such as one held in a variable first.
+func collectQueries(body *ast.BlockStmt) []SQLQuery {
+	if body == nil {
+		return nil
+	}
+	kinds := make(map[*ast.BasicLit]string)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		kind, ok := sqlCalls[sel.Sel.Name]
+		at := 0
+		if strings.HasSuffix(sel.Sel.Name, "Context") {
+			at = 1
+		}
+		if !ok || len(call.Args) <= at {
+			return true
+		}
+		if lit, ok := call.Args[at].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			kinds[lit] = kind
+		}
+		return true
+	})
+
+	var queries []SQLQuery
+	seen := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		lit, ok := n.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		text, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return true
+		}
+		text = strings.TrimSpace(text)
+		kind := kinds[lit]
+		if kind == "" {
+			if !sqlStatement.MatchString(text) {
+				return true
+			}
+			kind = statementKind(text)
+		}
+		if seen[kind+text] {
+			return true
+		}
+		seen[kind+text] = true
+		// sqlmock collapses whitespace before matching, so a multi-line
+		// statement can go on one line
+		q := SQLQuery{SQL: strconv.Quote(strings.Join(strings.Fields(text), " ")), Kind: kind}
+		if kind == "Query" {
+			q.Columns = selectColumns(text)
+		}
+		queries = append(queries, q)
+		return true
+	})
+	return queries
+}
+
+// statementKind tells a statement reading rows, a query, from one only
+// changing them, which sqlmock expects as an exec.
+func statementKind(text string) string {
+	upper := strings.ToUpper(text)
+	if strings.HasPrefix(upper, "SELECT") || strings.HasPrefix(upper, "WITH") || strings.Contains(upper, " RETURNING ") {
+		return "Query"
+	}
+	return "Exec"
+}
+
+// selectColumns returns the names of the columns a SELECT lists, quoted,
+// or nil when it selects * or expressions whose column names are not plain.
+func selectColumns(text string) []string {
+	norm := strings.Join(strings.Fields(text), " ")
+	upper := strings.ToUpper(norm)
+	from := strings.Index(upper, " FROM ")
+	if !strings.HasPrefix(upper, "SELECT ") || from < 0 {
+		return nil
+	}
+	list := norm[len("SELECT "):from]
+	if strings.ContainsAny(list, "*()") {
+		return nil
+	}
+	var columns []string
+	for _, part := range strings.Split(list, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 {
+			return nil
+		}
+		name := words[len(words)-1] // the alias, or the column itself
+		name = name[strings.LastIndexByte(name, '.')+1:]
+		columns = append(columns, strconv.Quote(strings.Trim(name, "`\"")))
+	}
+	return columns
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// status receives progress messages. When generated files are streamed to
+// stdout, it moves to stderr so the stream stays clean.
+var status io.Writer = os.Stdout
+
+// streamTar is the archive being written with -output=tar, opened on first use.
+var streamTar *tar.Writer
+
+// streamName is how a generated file is named in the stream: relative to
+// the working directory when it lies below it.
+func streamName(filename string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, filename); err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(filename)
+}
+
+// streamFile writes a generated file to stdout instead of the repository,
+// after a `--- name ---` line or as a tar entry.
+func streamFile(filename string, content []byte) error {
+	name := streamName(filename)
+	if *output == "stdout" {
+		_, err := fmt.Printf("--- %s ---\n%s", name, content)
+		return err
+	}
+
+	if streamTar == nil {
+		streamTar = tar.NewWriter(os.Stdout)
+	}
+	err := streamTar.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Unix(0, 0), // keeps the archive reproducible
+	})
+	if err != nil {
+		return err
+	}
+	_, err = streamTar.Write(content)
+	return err
+}
+
+// closeStream finishes the tar archive, if one was started.
+func closeStream() error {
+	if streamTar == nil {
+		return nil
+	}
+	return streamTar.Close()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tagsFile checks the struct tags of a package with -struct-tags.
+const tagsFile = "twintest_tags_test.go"
+
+// TagsConfig is the tags section of .twintest.yaml, the policy the
+// -struct-tags test holds struct tags to. Left out, each part has a default.
+type TagsConfig struct {
+	// Keys are the tags checked to be well formed, and which make a struct
+	// worth checking: json, yaml, db and validate by default.
+	Keys []string `yaml:"keys"`
+
+	// Require maps a tag to the ones a field carrying it must carry too;
+	// by default a field with a db tag needs a json one.
+	Require map[string][]string `yaml:"require"`
+
+	// Consistent lists the tags that must name a field alike: json and
+	// yaml by default.
+	Consistent []string `yaml:"consistent"`
+}
+
+// withDefaults fills in the parts of c the configuration leaves out.
+func (c TagsConfig) withDefaults() TagsConfig {
+	if c.Keys == nil {
+		c.Keys = []string{"json", "yaml", "db", "validate"}
+	}
+	if c.Require == nil {
+		c.Require = map[string][]string{"db": {"json"}}
+	}
+	if c.Consistent == nil {
+		c.Consistent = []string{"json", "yaml"}
+	}
+	return c
+}
+
+// taggedStructs lists, sorted, the non-generic struct types declared in the
+// package pkgName in dir, in the files the current build includes, with a
+// field tagged with one of keys.
+func taggedStructs(dir, pkgName string, keys []string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil || f.Name.Name != pkgName {
+			continue
+		}
+		for _, decl := range f.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				ts := spec.(*ast.TypeSpec)
+				st, ok := ts.Type.(*ast.StructType)
+				if ok && ts.TypeParams == nil && hasTag(st, keys) {
+					names = append(names, ts.Name.Name)
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasTag reports whether a field of st has a tag with one of keys, well
+// formed or not.
+func hasTag(st *ast.StructType, keys []string) bool {
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, _ := strconv.Unquote(field.Tag.Value)
+		for _, key := range keys {
+			if _, ok := reflect.StructTag(tag).Lookup(key); ok || strings.Contains(tag, key+":") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TraceRow maps one branch to the tests claiming to cover it.
+type TraceRow struct {
+	File      string   `json:"file"`
+	Function  string   `json:"function"` // Receiver.Method or Func
+	Line      int      `json:"line"`
+	Code      string   `json:"code"`
+	Claimants []string `json:"claimants"` // test functions, as file:line Name
+}
+
+// TraceReport is the traceability matrix of `twintest trace`.
+type TraceReport struct {
+	Branches  []TraceRow `json:"branches"`
+	Unclaimed int        `json:"unclaimed"`
+}
+
+// branchID matches the `// @123` branch IDs generated tests carry.
+var branchID = regexp.MustCompile(`^//\s*@(\d+)\b`)
+
+// runTrace implements `twintest trace [-format json|html] [path ...]`,
+// matching the branch IDs in test files against the branches of the source.
+func runTrace(args []string) error {
+	flags := flag.NewFlagSet("trace", flag.ExitOnError)
+	format := flags.String("format", "json", "report format: 'json' or 'html'")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: twintest trace [-format json|html] [file.go | dir | dir/...]...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *format != "json" && *format != "html" {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := sourceFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	report, err := trace(files)
+	if err != nil {
+		return err
+	}
+	if *format == "html" {
+		return traceHTML.Execute(os.Stdout, report)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// trace builds the matrix for the given source files from the tests next to
+// them. A test claims a branch when it carries the branch's ID and is named
+// after the branch's function, as generated tests are.
+func trace(files []string) (*TraceReport, error) {
+	claims := make(map[string]map[string][]string) // dir -> "Func@line" -> claimants
+	report := &TraceReport{Branches: []TraceRow{}}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if claims[dir] == nil {
+			c, err := testClaims(dir)
+			if err != nil {
+				return nil, err
+			}
+			claims[dir] = c
+		}
+
+		structInfo, _, err := ParseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		sortByPosition(structInfo)
+		for _, si := range structInfo {
+			if si.IsInterface {
+				continue
+			}
+			for _, fn := range si.Methods {
+				name := fn.Name
+				if fn.Receiver != "" {
+					name = fn.Receiver + "." + fn.Name
+				}
+				for _, b := range flattenBranches(fn.Branches) {
+					row := TraceRow{
+						File:      file,
+						Function:  name,
+						Line:      b.Line,
+						Code:      b.CodeLine,
+						Claimants: claims[dir][name+"@"+strconv.Itoa(b.Line)],
+					}
+					if row.Claimants == nil {
+						row.Claimants = []string{}
+						report.Unclaimed++
+					}
+					report.Branches = append(report.Branches, row)
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// testClaims collects the branch IDs in the test files of dir, keyed by the
+// function they belong to: Test_F claims for F, and a Test_M method of an
+// XTestSuite for X.M.
+func testClaims(dir string) (map[string][]string, error) {
+	tests, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	claims := make(map[string][]string)
+	for _, test := range tests {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, test, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || !strings.HasPrefix(fn.Name.Name, "Test_") || fn.Body == nil {
+				continue
+			}
+			name := strings.TrimPrefix(fn.Name.Name, "Test_")
+			if recv := GetReceiverType(fn); recv != "" {
+				name = strings.TrimSuffix(recv, "TestSuite") + "." + name
+			}
+			claimant := fmt.Sprintf("%s:%d %s", test, fset.Position(fn.Pos()).Line, fn.Name.Name)
+
+			seen := make(map[string]bool)
+			for _, group := range f.Comments {
+				if group.Pos() < fn.Body.Lbrace || group.End() > fn.Body.Rbrace {
+					continue
+				}
+				for _, c := range group.List {
+					if m := branchID.FindStringSubmatch(c.Text); m != nil && !seen[m[1]] {
+						seen[m[1]] = true
+						key := name + "@" + m[1]
+						claims[key] = append(claims[key], claimant)
+					}
+				}
+			}
+		}
+	}
+	return claims, nil
+}
+
+var traceHTML = template.Must(template.New("trace").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>twintest traceability</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+tr.unclaimed { background: #fdd; }
+code { white-space: pre; }
+</style>
+</head>
+<body>
+<h1>Branch traceability</h1>
+<p>{{ len .Branches }} branches, {{ .Unclaimed }} without a claiming test.</p>
+<table>
+<tr><th>File</th><th>Function</th><th>Line</th><th>Branch</th><th>Claimed by</th></tr>
+{{- range .Branches }}
+<tr{{ if not .Claimants }} class="unclaimed"{{ end }}>
+<td>{{ .File }}</td><td>{{ .Function }}</td><td>{{ .Line }}</td><td><code>{{ .Code }}</code></td>
+<td>{{ range .Claimants }}{{ . }}<br>{{ else }}none{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
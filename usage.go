@@ -0,0 +1,1308 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importTable maps the local names of a file's imports to their paths.
+// Blank and dot imports cannot qualify anything and are left out.
+func importTable(node *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range node.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := importName(spec)
+		if name != "_" && name != "." {
+			imports[name] = path
+		}
+	}
+	return imports
+}
+
+// collectCalls records the package-qualified functions called in body,
+// keyed by import path and name, e.g. "log/slog.Info" or "time.Now".
+func collectCalls(body *ast.BlockStmt, imports map[string]string) map[string]bool {
+	calls := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				if path, ok := imports[x.Name]; ok {
+					calls[path+"."+sel.Sel.Name] = true
+				}
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// callsPackage reports whether fn calls any function of the package at path.
+func (fn FuncInfo) callsPackage(path string) bool {
+	for call := range fn.Calls {
+		if strings.HasPrefix(call, path+".") && !strings.Contains(call[len(path)+1:], ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// typePackage returns the import path qualifying a type expression such as
+// *slog.Logger or []zap.Field, or "" for unqualified types.
+func typePackage(typ string, imports map[string]string) string {
+	typ = strings.TrimLeft(typ, "*[]")
+	dot := strings.Index(typ, ".")
+	if dot < 0 {
+		return ""
+	}
+	return imports[typ[:dot]]
+}
+
+// loggerPackages lists the supported logging libraries and their import paths.
+var loggerPackages = []struct{ lib, path string }{
+	{"slog", "log/slog"},
+	{"logrus", "github.com/sirupsen/logrus"},
+	{"zap", "go.uber.org/zap"},
+}
+
+// detectLogger finds the logging library a struct logs through, either via a
+// logger field or via the library's package-level functions in its methods.
+func detectLogger(si *StructInfo, imports map[string]string) {
+	for _, field := range si.Fields {
+		path := typePackage(field.Type, imports)
+		for _, pkg := range loggerPackages {
+			if path == pkg.path {
+				si.Logger = pkg.lib
+				return
+			}
+		}
+	}
+
+	for i := range si.Methods {
+		for _, pkg := range loggerPackages {
+			if si.Methods[i].callsPackage(pkg.path) {
+				si.Logger = pkg.lib
+				si.LoggerGlobal = true
+				return
+			}
+		}
+	}
+}
+
+// UsesClock reports whether fn reads the wall clock directly, which makes
+// its time-dependent branches flaky unless a clock seam is injected.
+func (fn FuncInfo) UsesClock() bool {
+	return fn.Calls["time.Now"] || fn.Calls["time.Since"] || fn.Calls["time.Until"]
+}
+
+// timerCalls are the time functions that wait, which tests run in a
+// testing/synctest bubble to take no real time.
+var timerCalls = []string{"time.Sleep", "time.After", "time.AfterFunc", "time.NewTimer", "time.NewTicker", "time.Tick"}
+
+// UsesTimers reports whether fn sleeps or waits on timers or tickers.
+func (fn FuncInfo) UsesTimers() bool {
+	for _, call := range timerCalls {
+		if fn.Calls[call] {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesClock reports whether any method reads the wall clock directly.
+func (si *StructInfo) UsesClock() bool {
+	for i := range si.Methods {
+		if si.Methods[i].UsesClock() {
+			return true
+		}
+	}
+	return false
+}
+
+// randPackages lists the math/rand flavors whose use makes results nondeterministic.
+var randPackages = []string{"math/rand", "math/rand/v2"}
+
+// UsesRand reports whether fn draws from math/rand's package-level source.
+func (fn FuncInfo) UsesRand() bool {
+	for _, path := range randPackages {
+		if fn.callsPackage(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectRand records which math/rand flavor a struct depends on, through a
+// *rand.Rand field or its methods, so the suite can seed a source for it.
+func detectRand(si *StructInfo, imports map[string]string) {
+	for _, field := range si.Fields {
+		for _, path := range randPackages {
+			if typePackage(field.Type, imports) == path {
+				si.Rand = path
+			}
+		}
+	}
+	for i := range si.Methods {
+		for _, path := range randPackages {
+			if si.Rand == "" && si.Methods[i].callsPackage(path) {
+				si.Rand = path
+			}
+		}
+	}
+}
+
+// fsWriteCalls are the os functions that create, change or remove files.
+var fsWriteCalls = []string{
+	"os.Create", "os.CreateTemp", "os.WriteFile", "os.OpenFile",
+	"os.Mkdir", "os.MkdirAll", "os.MkdirTemp",
+	"os.Remove", "os.RemoveAll", "os.Rename", "os.Symlink", "os.Chmod",
+}
+
+// TouchesFS reports whether fn writes to the filesystem.
+func (fn FuncInfo) TouchesFS() bool {
+	for _, call := range fsWriteCalls {
+		if fn.Calls[call] {
+			return true
+		}
+	}
+	return false
+}
+
+// PathParams returns the string parameters of fn that look like file
+// system paths by name, e.g. path, dir or outFile.
+func (fn FuncInfo) PathParams() []string {
+	var names []string
+	for _, param := range fn.Params {
+		name := strings.ToLower(param.Name)
+		if param.Type != "string" {
+			continue
+		}
+		if strings.Contains(name, "path") || strings.Contains(name, "dir") ||
+			strings.Contains(name, "file") || strings.Contains(name, "folder") {
+			names = append(names, param.Name)
+		}
+	}
+	return names
+}
+
+// scaffolded returns the parameters of fn its test declares a variable of the
+// same name for in its notes: a path under t.TempDir or an fstest.MapFS.
+func (fn FuncInfo) scaffolded() map[string]bool {
+	names := make(map[string]bool)
+	for _, dep := range fn.FSParams {
+		names[dep.Name] = true
+	}
+	if fn.TouchesFS() {
+		for _, name := range fn.PathParams() {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Args renders the arguments of a call to fn in the scope of its test, with
+// n arguments for a variadic parameter: zero values, except that parameters
+// the notes declare a variable for are passed that variable.
+func (fn FuncInfo) Args(n int) string {
+	scaffolded := fn.scaffolded()
+	args := make([]string, 0, len(fn.Params)+n)
+	for _, param := range fn.Params {
+		switch {
+		case param.Variadic:
+			for range n {
+				args = append(args, zeroValue(param.Elem()))
+			}
+		case scaffolded[param.Name]:
+			args = append(args, param.Name)
+		default:
+			args = append(args, zeroValue(param.Type))
+		}
+	}
+	return strings.Join(args, ", ")
+}
+
+// CallsWithArgs reports whether the test of fn always calls it with Args,
+// so that the variables its notes declare are used.
+func (fn FuncInfo) CallsWithArgs() bool {
+	if fn.Recursive || fn.Hot != nil || fn.Variadic() != nil {
+		return true
+	}
+	return anyBranch(fn.Branches, func(b *Branch) bool {
+		return len(b.Children) == 0 && (b.Type == BranchPanic || fn.prefills(b))
+	})
+}
+
+// EnvVar is an environment variable read by a function, by display name and
+// by the expression naming it in the source, e.g. "HOME" or envKey.
+type EnvVar struct {
+	Name string
+	Expr string
+}
+
+// collectEnvVars records the variables body reads with os.Getenv or
+// os.LookupEnv, when the key is a string literal or a named constant.
+func collectEnvVars(body *ast.BlockStmt, imports map[string]string) []EnvVar {
+	var vars []EnvVar
+	seen := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "Getenv" && sel.Sel.Name != "LookupEnv") {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || imports[x.Name] != "os" {
+			return true
+		}
+
+		var v EnvVar
+		switch arg := call.Args[0].(type) {
+		case *ast.BasicLit:
+			if arg.Kind != token.STRING {
+				return true
+			}
+			v.Name, _ = strconv.Unquote(arg.Value)
+			v.Expr = arg.Value
+		case *ast.Ident:
+			if !isConstKey(arg) {
+				return true // a local the test cannot name
+			}
+			v.Name, v.Expr = arg.Name, arg.Name
+		default:
+			return true
+		}
+		if !seen[v.Expr] {
+			seen[v.Expr] = true
+			vars = append(vars, v)
+		}
+		return true
+	})
+	return vars
+}
+
+// fileReaders are the calls reading a file whose path is their first argument.
+var fileReaders = map[string]bool{
+	"os.Open": true, "os.OpenFile": true, "os.ReadFile": true, "io/ioutil.ReadFile": true,
+}
+
+// collectReadPaths records the relative paths body reads files from as
+// string literals, which go test resolves against the package directory.
+func collectReadPaths(body *ast.BlockStmt, imports map[string]string) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || !fileReaders[imports[x.Name]+"."+sel.Sel.Name] {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		p, err := strconv.Unquote(lit.Value)
+		if err != nil || !filepath.IsLocal(p) {
+			return true // absolute paths cannot be pointed elsewhere
+		}
+		if p = filepath.ToSlash(filepath.Clean(p)); !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+		return true
+	})
+	return paths
+}
+
+// FilesDir is the directory under testdata/ holding the files fn reads,
+// which its test runs in.
+func (fn FuncInfo) FilesDir() string {
+	return fn.DataDir() + "_files"
+}
+
+// HasReadPaths reports whether any method reads files by literal paths,
+// for the file to carry the helper changing into their directory.
+func (si *StructInfo) HasReadPaths() bool {
+	for _, fn := range si.Methods {
+		if len(fn.ReadPaths) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeReadFiles creates a placeholder under testdata/ for every file the
+// methods of si read by a literal path, unless it exists already.
+func writeReadFiles(dir string, si *StructInfo, report func(string, bool)) error {
+	for _, fn := range si.Methods {
+		for _, p := range fn.ReadPaths {
+			file := filepath.Join(dir, "testdata", fn.FilesDir(), filepath.FromSlash(p))
+			if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			var content []byte
+			if filepath.Ext(p) == ".json" {
+				content = []byte("{}\n")
+			}
+			if *output == "files" {
+				if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+					return err
+				}
+			}
+			written, err := writeGenerated(file, content)
+			if err != nil {
+				return err
+			}
+			report(file, written)
+		}
+	}
+	return nil
+}
+
+// collectFieldRefs records the fields body selects from the receiver recv.
+func collectFieldRefs(body *ast.BlockStmt, recv string) map[string]bool {
+	refs := make(map[string]bool)
+	if recv == "" {
+		return refs
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Name == recv {
+				refs[sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// packageVars returns the package-level variable declarations of a file,
+// which identifiers resolve to when they refer to one.
+func packageVars(node *ast.File) map[*ast.ValueSpec]bool {
+	vars := make(map[*ast.ValueSpec]bool)
+	for _, decl := range node.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.VAR {
+			for _, spec := range gen.Specs {
+				vars[spec.(*ast.ValueSpec)] = true
+			}
+		}
+	}
+	return vars
+}
+
+// collectGlobalWrites lists the package-level variables body assigns to,
+// as a whole or through a field or index, or increments, so tests can put
+// them back afterwards.
+func collectGlobalWrites(body *ast.BlockStmt, globals map[*ast.ValueSpec]bool) []string {
+	written := make(map[string]bool)
+	mark := func(expr ast.Expr) {
+		for {
+			switch e := expr.(type) {
+			case *ast.SelectorExpr:
+				expr = e.X
+				continue
+			case *ast.IndexExpr:
+				expr = e.X
+				continue
+			case *ast.StarExpr:
+				expr = e.X
+				continue
+			case *ast.ParenExpr:
+				expr = e.X
+				continue
+			case *ast.Ident:
+				if e.Obj != nil && e.Obj.Kind == ast.Var && e.Name != "_" {
+					if spec, ok := e.Obj.Decl.(*ast.ValueSpec); ok && globals[spec] {
+						written[e.Name] = true
+					}
+				}
+			}
+			return
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch s := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range s.Lhs {
+				mark(lhs)
+			}
+		case *ast.IncDecStmt:
+			mark(s.X)
+		}
+		return true
+	})
+	return sortedKeys(written)
+}
+
+// Globals lists the package-level variables any method assigns, which the
+// generated tests save and restore.
+func (si *StructInfo) Globals() []string {
+	seen := make(map[string]bool)
+	for _, fn := range si.Methods {
+		for _, name := range fn.Globals {
+			seen[name] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+// SetsFlags reports whether any method registers flags on flag.CommandLine,
+// for the generated tests to swap in a fresh set.
+func (si *StructInfo) SetsFlags() bool {
+	for _, fn := range si.Methods {
+		if fn.SetsFlags {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSQL marks structs holding a *sql.DB/*sql.Tx, or whose methods call
+// database/sql, and the methods that go through them, for a sqlmock harness.
+func detectSQL(si *StructInfo, imports map[string]string) {
+	sqlFields := make(map[string]bool)
+	for _, field := range si.Fields {
+		if typePackage(field.Type, imports) == "database/sql" {
+			sqlFields[field.Name] = true
+		}
+	}
+
+	for i := range si.Methods {
+		method := &si.Methods[i]
+		method.UsesSQL = method.callsPackage("database/sql")
+		for name := range method.FieldRefs {
+			if sqlFields[name] {
+				method.UsesSQL = true
+			}
+		}
+		if method.UsesSQL {
+			si.SQL = true
+		}
+	}
+}
+
+// httpClientCalls are the net/http functions that reach out to a server.
+var httpClientCalls = []string{
+	"net/http.Get", "net/http.Head", "net/http.Post", "net/http.PostForm",
+	"net/http.NewRequest", "net/http.NewRequestWithContext",
+}
+
+// detectHTTP marks structs holding an *http.Client, or whose methods issue
+// requests through net/http, for an httptest.Server harness.
+func detectHTTP(si *StructInfo, imports map[string]string) {
+	clientFields := make(map[string]bool)
+	for _, field := range si.Fields {
+		if typePackage(field.Type, imports) == "net/http" && strings.HasSuffix(field.Type, "Client") {
+			clientFields[field.Name] = true
+		}
+		name := strings.ToLower(field.Name)
+		if field.Type == "string" && si.URLField == "" &&
+			(strings.Contains(name, "url") || strings.Contains(name, "endpoint") ||
+				strings.Contains(name, "addr") || strings.Contains(name, "host")) {
+			si.URLField = field.Name
+		}
+	}
+
+	for i := range si.Methods {
+		method := &si.Methods[i]
+		for _, call := range httpClientCalls {
+			if method.Calls[call] {
+				method.UsesHTTP = true
+			}
+		}
+		for name := range method.FieldRefs {
+			if clientFields[name] {
+				method.UsesHTTP = true
+			}
+		}
+		if method.UsesHTTP {
+			si.HTTP = true
+		}
+	}
+}
+
+// detectMutex records the sync.Mutex or sync.RWMutex field of a struct, named
+// or embedded, whose exported methods get a concurrent access test.
+func detectMutex(si *StructInfo, imports map[string]string) {
+	for _, field := range si.Fields {
+		typ := strings.TrimPrefix(field.Type, "*")
+		if typePackage(typ, imports) != "sync" || !strings.HasSuffix(typ, ".Mutex") && !strings.HasSuffix(typ, ".RWMutex") {
+			continue
+		}
+		si.Mutex = field.Name
+		if si.Mutex == "" {
+			si.Mutex = typ[strings.LastIndex(typ, ".")+1:]
+		}
+		return
+	}
+}
+
+// Concurrent lists the exported methods the concurrent access test of a
+// mutex-guarded struct calls, or none if the struct has no mutex.
+func (si *StructInfo) Concurrent() []FuncInfo {
+	if si.Mutex == "" {
+		return nil
+	}
+	var methods []FuncInfo
+	for _, fn := range si.Methods {
+		if fn.IsExported {
+			methods = append(methods, fn)
+		}
+	}
+	return methods
+}
+
+// IOImpl describes a struct implementing io.Reader, io.Writer or io.Closer,
+// which gets testing/iotest checks for short reads, errors mid-stream and
+// close semantics.
+type IOImpl struct {
+	Reader bool
+	Writer bool
+	Closer bool
+	Source string // io.Reader field the struct reads from, if any
+	Sink   string // io.Writer field the struct writes to, if any
+}
+
+// detectIO records which of io.Reader, io.Writer and io.Closer a struct
+// implements, by the signatures of its methods, and the fields it wraps.
+func detectIO(si *StructInfo, imports map[string]string) {
+	impl := &IOImpl{}
+	for _, fn := range si.Methods {
+		sig := fieldTypes(fn.Params) + " " + fieldTypes(fn.Results)
+		switch {
+		case fn.Name == "Read" && sig == "[]byte int,error":
+			impl.Reader = true
+		case fn.Name == "Write" && sig == "[]byte int,error":
+			impl.Writer = true
+		case fn.Name == "Close" && sig == " error":
+			impl.Closer = true
+		}
+	}
+	if !impl.Reader && !impl.Writer && !impl.Closer {
+		return
+	}
+	for _, field := range si.Fields {
+		if field.Name == "" || typePackage(field.Type, imports) != "io" {
+			continue
+		}
+		iface := field.Type[strings.LastIndex(field.Type, ".")+1:]
+		if impl.Source == "" && (iface == "Reader" || iface == "ReadCloser") {
+			impl.Source = field.Name
+		}
+		if impl.Sink == "" && (iface == "Writer" || iface == "WriteCloser") {
+			impl.Sink = field.Name
+		}
+	}
+	si.IO = impl
+}
+
+// fieldTypes joins the types of fields with commas, e.g. "int,error".
+func fieldTypes(fields []Field) string {
+	types := make([]string, len(fields))
+	for i, f := range fields {
+		types[i] = f.Type
+	}
+	return strings.Join(types, ",")
+}
+
+// UsesExec reports whether fn spawns subprocesses through os/exec.
+func (fn FuncInfo) UsesExec() bool {
+	return fn.callsPackage("os/exec")
+}
+
+// UsesExec reports whether any method spawns subprocesses through os/exec.
+func (si *StructInfo) UsesExec() bool {
+	for i := range si.Methods {
+		if si.Methods[i].UsesExec() {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature renders the field's function type with every parameter named.
+func (f FuncField) Signature() string {
+	params := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		params[i] = p.Name + " " + p.Type
+	}
+	sig := "func(" + strings.Join(params, ", ") + ")"
+
+	results := make([]string, len(f.Results))
+	for i, r := range f.Results {
+		results[i] = r.Type
+	}
+	switch len(results) {
+	case 0:
+		return sig
+	case 1:
+		return sig + " " + results[0]
+	default:
+		return sig + " (" + strings.Join(results, ", ") + ")"
+	}
+}
+
+// ArgNames lists the parameter names, comma separated.
+func (f FuncField) ArgNames() string {
+	names := make([]string, len(f.Params))
+	for i, p := range f.Params {
+		names[i] = p.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// ZeroResults lists the zero value of every result, comma separated.
+func (f FuncField) ZeroResults() string {
+	zeros := make([]string, len(f.Results))
+	for i, r := range f.Results {
+		zeros[i] = zeroValue(r.Type)
+	}
+	return strings.Join(zeros, ", ")
+}
+
+// detectHooks records which function-typed fields each method calls through,
+// so leaves can assert on the recorded call counts.
+func detectHooks(si *StructInfo) {
+	for _, f := range si.FuncFields {
+		for i := range si.Methods {
+			if si.Methods[i].FieldRefs[f.Name] {
+				si.Methods[i].Hooks = append(si.Methods[i].Hooks, f.Name)
+			}
+		}
+	}
+}
+
+// isAccessor reports whether body is a trivial accessor of the receiver recv:
+// a lone `return recv.field` or a lone `recv.field = value`.
+func isAccessor(body *ast.BlockStmt, recv string) bool {
+	if recv == "" || len(body.List) != 1 {
+		return false
+	}
+	isField := func(expr ast.Expr) bool {
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok {
+			return false
+		}
+		x, ok := sel.X.(*ast.Ident)
+		return ok && x.Name == recv
+	}
+
+	switch stmt := body.List[0].(type) {
+	case *ast.ReturnStmt:
+		return len(stmt.Results) == 1 && isField(stmt.Results[0])
+	case *ast.AssignStmt:
+		if stmt.Tok != token.ASSIGN || len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+			return false
+		}
+		_, simple := stmt.Rhs[0].(*ast.Ident)
+		return isField(stmt.Lhs[0]) && simple
+	}
+	return false
+}
+
+// isWrapper reports whether body is a thin delegation wrapper: a lone call,
+// or a lone return of one, to a named function or method, passing on only
+// its own parameters, its receiver and fields of them. A call building a
+// value from literals, such as errors.New("closed"), or a panic is not
+// forwarding anything.
+func isWrapper(body *ast.BlockStmt, recvName string, params []Field) bool {
+	if body == nil || len(body.List) != 1 {
+		return false
+	}
+	var call *ast.CallExpr
+	switch stmt := body.List[0].(type) {
+	case *ast.ExprStmt:
+		call, _ = stmt.X.(*ast.CallExpr)
+	case *ast.ReturnStmt:
+		if len(stmt.Results) == 1 {
+			call, _ = stmt.Results[0].(*ast.CallExpr)
+		}
+	}
+	if call == nil || forwardedRoot(call.Fun) == nil {
+		return false
+	}
+	if id, ok := call.Fun.(*ast.Ident); ok && id.Obj == nil && id.Name == "panic" {
+		return false
+	}
+	own := make(map[string]bool, len(params)+1)
+	for _, p := range params {
+		own[p.Name] = true
+	}
+	if recvName != "" {
+		own[recvName] = true
+	}
+	for _, arg := range call.Args {
+		if root := forwardedRoot(arg); root == nil || !own[root.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// forwardedRoot returns the identifier expr is or a chain of selectors on it
+// starts from, such as c for c.cfg.Name, or nil when expr is neither.
+func forwardedRoot(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			return e
+		case *ast.SelectorExpr:
+			expr = e.X
+		default:
+			return nil
+		}
+	}
+}
+
+// ReturnsChan reports whether fn returns a channel the test can receive from.
+func (fn FuncInfo) ReturnsChan() bool {
+	for _, r := range fn.Results {
+		if isRecvChan(r.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChanParam is a channel parameter of a function under test. The harness
+// feeds channels the function receives from, and drains those it only sends to.
+type ChanParam struct {
+	Name string // local variable holding the channel
+	Elem string // element type
+	Feed bool   // whether the test sends values into it
+}
+
+// chanElem returns the element type of the channel type typ.
+func chanElem(typ string) string {
+	for _, prefix := range []string{"<-chan ", "chan<- ", "chan "} {
+		if strings.HasPrefix(typ, prefix) {
+			return strings.Trim(strings.TrimPrefix(typ, prefix), "()")
+		}
+	}
+	return typ
+}
+
+// ChanParams returns fn's channel parameters, named after the parameters
+// where they are usable as locals.
+func (fn FuncInfo) ChanParams() []ChanParam {
+	var chans []ChanParam
+	for i, p := range fn.Params {
+		if p.Variadic || !strings.HasPrefix(p.Type, "chan") && !strings.HasPrefix(p.Type, "<-chan") {
+			continue
+		}
+		name := p.Name
+		if name == "" || name == "_" || name == "t" || name == "ctx" {
+			name = "ch" + strconv.Itoa(i)
+		}
+		chans = append(chans, ChanParam{Name: name, Elem: chanElem(p.Type), Feed: !strings.HasPrefix(p.Type, "chan<-")})
+	}
+	return chans
+}
+
+// ChanResults returns the variables ChanCall assigns fn's receivable channel
+// results to.
+func (fn FuncInfo) ChanResults() []Field {
+	var vars []Field
+	got := fn.GotNames()
+	for i, r := range fn.Results {
+		if isRecvChan(r.Type) {
+			vars = append(vars, Field{Name: got[i], Type: r.Type})
+		}
+	}
+	return vars
+}
+
+// ChanCall renders a call to fn passing the harness's channels, its deadline
+// ctx for a context and zero values for the other parameters, assigning only
+// its channel results.
+func (fn FuncInfo) ChanCall() string {
+	chans := fn.ChanParams()
+	args := make([]string, 0, len(fn.Params))
+	for _, p := range fn.Params {
+		switch {
+		case p.Variadic:
+		case strings.HasPrefix(p.Type, "chan") || strings.HasPrefix(p.Type, "<-chan"):
+			args = append(args, chans[0].Name)
+			chans = chans[1:]
+		case p.Type == "context.Context":
+			args = append(args, "ctx")
+		default:
+			args = append(args, zeroValue(p.Type))
+		}
+	}
+	call := fn.Callee() + "(" + strings.Join(args, ", ") + ")"
+	if !fn.ReturnsChan() {
+		return fn.Discard() + call
+	}
+	lhs := fn.GotNames()
+	for i, r := range fn.Results {
+		if !isRecvChan(r.Type) {
+			lhs[i] = "_"
+		}
+	}
+	return strings.Join(lhs, ", ") + " = " + call
+}
+
+// HasChans reports whether fn takes or returns channels.
+func (fn FuncInfo) HasChans() bool {
+	return fn.ReturnsChan() || len(fn.ChanParams()) > 0
+}
+
+// HasDeadline reports whether the generated file runs channel or concurrency
+// tests, or built binaries, under a deadline, and so declares the helpers for it.
+func (si *StructInfo) HasDeadline() bool {
+	for i := range si.Methods {
+		if si.Methods[i].HasChans() || si.Methods[i].Binary != nil {
+			return true
+		}
+	}
+	return len(si.Concurrent()) > 0
+}
+
+// ReturnsError reports whether fn's last result is an error.
+func (fn FuncInfo) ReturnsError() bool {
+	return len(fn.Results) > 0 && isErrorType(fn.Results[len(fn.Results)-1].Type)
+}
+
+// ReturnsFunc reports whether fn returns a function value, other than an
+// iterator.
+func (fn FuncInfo) ReturnsFunc() bool {
+	for _, r := range fn.Results {
+		if isFuncType(r.Type) && !isIter(r.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// suiteNames are the identifiers the generated suites already use, for their
+// own fields or as locals next to the sut, such as the loop variable of a
+// benchmark, which the sut cannot be named.
+var suiteNames = map[string]bool{
+	"suite": true, "t": true, "b": true, "i": true, "allocs": true, "tt": true, "err": true, "ctx": true, "cancel": true,
+	"want": true, "got": true, "tests": true, "fixed": true, "data": true, "buf": true,
+	"logs": true, "logger": true, "prevLogger": true, "now": true, "rng": true,
+	"db": true, "mock": true, "server": true, "handler": true, "runner": true,
+}
+
+// nameSut names the suite's field for the struct under test after the
+// receiver its methods use most, such as c for `func (c *Client)`, so the
+// tests read like the code; it is "sut" when they use none or the name is
+// taken, by a suite field, a generated local or an import.
+func nameSut(si *StructInfo) {
+	counts := make(map[string]int)
+	best := ""
+	for _, fn := range si.Methods {
+		if fn.RecvName == "" {
+			continue
+		}
+		counts[fn.RecvName]++
+		if counts[fn.RecvName] > counts[best] {
+			best = fn.RecvName
+		}
+	}
+	taken := suiteNames[best] || si.fileImports[best] != ""
+	for _, f := range si.Fields {
+		taken = taken || f.Name+"FS" == best
+	}
+	for _, f := range si.FuncFields {
+		taken = taken || "fake"+upperFirst(f.Name) == best || f.Name+"Calls" == best
+	}
+	si.Sut = best
+	if best == "" || taken {
+		si.Sut = "sut"
+	}
+	for i := range si.Methods {
+		si.Methods[i].Sut = si.Sut
+	}
+}
+
+// detectMethodSet applies the method-set rules to a struct: if any method has
+// a pointer receiver, only *T has the full method set, so the sut is a *T.
+func detectMethodSet(si *StructInfo) {
+	if si.Name == "" || si.IsInterface {
+		return
+	}
+	for i := range si.Methods {
+		if si.Methods[i].PtrRecv {
+			si.SutPointer = true
+		}
+	}
+	if !si.SutPointer {
+		return
+	}
+	for i := range si.Methods {
+		if !si.Methods[i].PtrRecv {
+			si.ValueMethods = append(si.ValueMethods, si.Methods[i].Name)
+		}
+	}
+}
+
+// collectLocalCalls records the calls fn's body makes to functions of its own
+// package, "F", and to methods through its receiver, "Type.Method", or through
+// receiver fields of the receiver's own type, as in trees and lists.
+func collectLocalCalls(body *ast.BlockStmt, recvType, recvName string, fields []Field) map[string]bool {
+	sameType := make(map[string]bool)
+	for _, f := range fields {
+		if strings.TrimPrefix(f.Type, "*") == recvType {
+			sameType[f.Name] = true
+		}
+	}
+	calls := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		switch fun := call.Fun.(type) {
+		case *ast.Ident:
+			calls[fun.Name] = true
+		case *ast.SelectorExpr:
+			x := fun.X
+			if field, ok := x.(*ast.SelectorExpr); ok && sameType[field.Sel.Name] {
+				x = field.X
+			}
+			if id, ok := x.(*ast.Ident); ok && recvName != "" && id.Name == recvName {
+				calls[recvType+"."+fun.Sel.Name] = true
+			}
+		}
+		return true
+	})
+	return calls
+}
+
+// key names fn the way collectLocalCalls records calls to it.
+func (fn FuncInfo) key() string {
+	if fn.Receiver == "" {
+		return fn.Name
+	}
+	return fn.Receiver + "." + fn.Name
+}
+
+// maxRecursionHops bounds the call chains searched for mutual recursion.
+const maxRecursionHops = 3
+
+// detectRecursion marks functions that call themselves, directly or through
+// a short chain of other functions in the file.
+func detectRecursion(structs []*StructInfo) {
+	funcs := make(map[string]*FuncInfo)
+	for _, si := range structs {
+		if si.IsInterface {
+			continue
+		}
+		for i := range si.Methods {
+			funcs[si.Methods[i].key()] = &si.Methods[i]
+		}
+	}
+
+	// via returns the first function called on the way back to target, or
+	// "" if target is not reached within hops calls.
+	var via func(from *FuncInfo, target string, hops int, seen map[string]bool) (string, bool)
+	via = func(from *FuncInfo, target string, hops int, seen map[string]bool) (string, bool) {
+		if hops == 0 {
+			return "", false
+		}
+		for _, callee := range sortedKeys(from.LocalCalls) {
+			if callee == target {
+				return "", true
+			}
+			next, ok := funcs[callee]
+			if !ok || seen[callee] {
+				continue
+			}
+			seen[callee] = true
+			if _, ok := via(next, target, hops-1, seen); ok {
+				return callee, true
+			}
+		}
+		return "", false
+	}
+
+	for _, fn := range funcs {
+		fn.RecursesVia, fn.Recursive = via(fn, fn.key(), maxRecursionHops, map[string]bool{})
+	}
+}
+
+// sortedKeys returns the keys of m in order, for deterministic results.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// detectConstructors finds the package functions constructing each
+// non-generic struct: named New, Must or Make and after the struct, and
+// returning a T or *T, optionally with an error.
+func detectConstructors(structs []*StructInfo) {
+	var funcs *StructInfo
+	for _, si := range structs {
+		if si.Name == "" {
+			funcs = si
+		}
+	}
+	if funcs == nil {
+		return
+	}
+	for _, si := range structs {
+		if si.Name == "" || si.IsInterface || si.TypeParams != "" {
+			continue
+		}
+		for _, fn := range funcs.Methods {
+			if fn.constructs(si.Name) {
+				si.Constructors = append(si.Constructors, fn)
+			}
+		}
+	}
+}
+
+// constructs reports whether fn looks like a constructor of the struct name.
+func (fn FuncInfo) constructs(name string) bool {
+	lower := strings.ToLower(fn.Name)
+	prefixed := false
+	for _, prefix := range []string{"new", "mustnew", "must", "make"} {
+		prefixed = prefixed || strings.HasPrefix(lower, prefix)
+	}
+	if !prefixed || !strings.Contains(lower, strings.ToLower(name)) {
+		return false
+	}
+	switch len(fn.Results) {
+	case 2:
+		if !isErrorType(fn.Results[1].Type) {
+			return false
+		}
+	case 1:
+	default:
+		return false
+	}
+	typ := fn.Results[0].Type
+	return typ == name || typ == "*"+name
+}
+
+// chooseConstructors picks the constructor each suite sets up with: the one
+// named by //twintest:ctor, else by the constructors of .twintest.yaml, else
+// New<T>, else the non-Must one taking the fewest parameters.
+func chooseConstructors(structInfo []*StructInfo) {
+	for _, si := range structInfo {
+		if len(si.Constructors) == 0 {
+			continue
+		}
+		want := si.CtorHint
+		if want == "" {
+			want = config.Constructors[si.Name]
+		}
+		if want == "" {
+			for _, fn := range si.Constructors {
+				if fn.Name == "New"+si.Name || fn.Name == "new"+upperFirst(si.Name) {
+					want = fn.Name
+				}
+			}
+		}
+
+		var best *FuncInfo
+		for i := range si.Constructors {
+			fn := &si.Constructors[i]
+			if fn.Name == want {
+				best = fn
+				break
+			}
+			must := strings.HasPrefix(strings.ToLower(fn.Name), "must")
+			if want == "" && !must && (best == nil || len(fn.Params) < len(best.Params)) {
+				best = fn
+			}
+		}
+		if best == nil && want != "" {
+			logEvent(os.Stderr, eventWarning, fmt.Sprintf("warning: %s has no constructor %s, using %s", si.Name, want, si.Constructors[0].Name),
+				"struct", si.Name, "constructor", want)
+		}
+		if best == nil {
+			best = &si.Constructors[0]
+		}
+		si.Ctor = best
+	}
+}
+
+// ConstructorTests lists the constructors tested in the suite: those
+// SetupTest does not call, and the one it does when it takes options.
+func (si *StructInfo) ConstructorTests() []FuncInfo {
+	if !si.CtorStubs {
+		return nil
+	}
+	var tests []FuncInfo
+	for _, fn := range si.Constructors {
+		if si.Ctor == nil || fn.Name != si.Ctor.Name || len(fn.Options) > 0 {
+			tests = append(tests, fn)
+		}
+	}
+	return tests
+}
+
+// CtorValue spells the sut from the local its constructor returns, named
+// like the sut, taking the address or dereferencing as the sut's type needs.
+func (si *StructInfo) CtorValue() string {
+	ptr := strings.HasPrefix(si.Ctor.Results[0].Type, "*")
+	switch {
+	case ptr && !si.SutPointer:
+		return "*" + si.Sut
+	case !ptr && si.SutPointer:
+		return "&" + si.Sut
+	}
+	return si.Sut
+}
+
+// optionTypes finds the functional option types declared in the file, such
+// as `type Option func(*Server)` or `type Option func(*Server) error`.
+func optionTypes(node *ast.File) map[string]bool {
+	types := make(map[string]bool)
+	for _, decl := range node.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			ft, ok := ts.Type.(*ast.FuncType)
+			if !ok || ts.TypeParams != nil || ft.Params.NumFields() != 1 {
+				continue
+			}
+			if _, ok := ft.Params.List[0].Type.(*ast.StarExpr); !ok {
+				continue
+			}
+			if n := ft.Results.NumFields(); n > 1 || n == 1 && !isErrorExpr(ft.Results.List[0].Type) {
+				continue
+			}
+			types[ts.Name.Name] = true
+		}
+	}
+	return types
+}
+
+// isErrorExpr reports whether expr spells the error type.
+func isErrorExpr(expr ast.Expr) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == "error"
+}
+
+// detectOptions links the functions taking variadic functional options to
+// the package functions returning such an option, the With* constructors.
+func detectOptions(structs []*StructInfo, options map[string]bool) {
+	var funcs *StructInfo
+	for _, si := range structs {
+		if si.Name == "" {
+			funcs = si
+		}
+	}
+	if funcs == nil || len(options) == 0 {
+		return
+	}
+	for _, si := range structs {
+		for i := range si.Methods {
+			fn := &si.Methods[i]
+			v := fn.Variadic()
+			if v == nil || !options[v.Elem()] {
+				continue
+			}
+			for _, opt := range funcs.Methods {
+				if len(opt.Results) == 1 && opt.Results[0].Type == v.Elem() {
+					fn.Options = append(fn.Options, opt)
+				}
+			}
+		}
+	}
+}
+
+// OptionCalls renders a call to each of fn's option constructors.
+func (fn FuncInfo) OptionCalls() []string {
+	calls := make([]string, len(fn.Options))
+	for i, opt := range fn.Options {
+		calls[i] = opt.Name + "(" + zeroArgs(opt.Params, 0) + ")"
+	}
+	return calls
+}
+
+// OptionArgs renders the arguments of a call to fn passing the options of
+// the table row tt.
+func (fn FuncInfo) OptionArgs() string {
+	args := fn.Args(0)
+	if args != "" {
+		args += ", "
+	}
+	return args + "tt.opts..."
+}
+
+// cancellableParam returns the context.Context parameter whose cancellation
+// body checks for, through ctx.Done() or ctx.Err(), or by comparing with
+// context.Canceled or context.DeadlineExceeded; or "" if there is none.
+func cancellableParam(body *ast.BlockStmt, params []Field, imports map[string]string) string {
+	ctx := ""
+	for _, p := range params {
+		if typePackage(p.Type, imports) == "context" && strings.HasSuffix(p.Type, ".Context") && p.Name != "" && p.Name != "_" {
+			ctx = p.Name
+			break
+		}
+	}
+	if ctx == "" || body == nil {
+		return ""
+	}
+	checked := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return !checked
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			switch {
+			case x.Name == ctx && (sel.Sel.Name == "Done" || sel.Sel.Name == "Err"):
+				checked = true
+			case imports[x.Name] == "context" && (sel.Sel.Name == "Canceled" || sel.Sel.Name == "DeadlineExceeded"):
+				checked = true
+			}
+		}
+		return !checked
+	})
+	if !checked {
+		return ""
+	}
+	return ctx
+}
+
+// CtxCall renders a call to fn passing ctx for its context parameter and
+// zero values for the others, assigning its error to err when it returns one.
+func (fn FuncInfo) CtxCall() string {
+	args := make([]string, 0, len(fn.Params))
+	for _, p := range fn.Params {
+		switch {
+		case p.Name == fn.CtxParam:
+			args = append(args, "ctx")
+		case p.Variadic:
+		default:
+			args = append(args, zeroValue(p.Type))
+		}
+	}
+	call := fn.Callee() + "(" + strings.Join(args, ", ") + ")"
+	if fn.ReturnsError() {
+		return strings.Repeat("_, ", len(fn.Results)-1) + "err := " + call
+	}
+	return fn.Discard() + call
+}
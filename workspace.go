@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goModule is a module of the workspace: its root directory and path.
+type goModule struct {
+	Dir  string
+	Path string
+}
+
+// findGoWork returns the go.work file governing dir, as the go command
+// finds it: $GOWORK when set, "off" meaning none, or the nearest go.work at
+// or above dir.
+func findGoWork(dir string) (string, error) {
+	switch env := os.Getenv("GOWORK"); env {
+	case "off":
+		return "", nil
+	case "":
+	default:
+		return env, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for ; ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return "", nil
+		}
+	}
+}
+
+// readGoWork lists the module directories a go.work file uses, absolute.
+func readGoWork(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dirs []string
+	add := func(dir string) {
+		dir = strings.Trim(strings.TrimSpace(dir), `"`)
+		if dir == "" {
+			return
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(path), dir)
+		}
+		dirs = append(dirs, filepath.Clean(dir))
+	}
+	block := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case block && line == ")":
+			block = false
+		case block:
+			add(line)
+		case line == "use (":
+			block = true
+		case strings.HasPrefix(line, "use "):
+			add(strings.TrimPrefix(line, "use "))
+		}
+	}
+	return dirs, scanner.Err()
+}
+
+// workspaceModules returns the modules dir belongs to for resolving package
+// paths: those its go.work uses, or else the module around it.
+func workspaceModules(dir string) ([]goModule, error) {
+	work, err := findGoWork(dir)
+	if err != nil {
+		return nil, err
+	}
+	var modules []goModule
+	var dirs []string
+	if work != "" {
+		if dirs, err = readGoWork(work); err != nil {
+			return nil, err
+		}
+	} else {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		root, _, _, err := readGoMod(abs)
+		if err != nil || root == "" {
+			return nil, err
+		}
+		dirs = []string{root}
+	}
+	for _, d := range dirs {
+		_, module, _, err := readGoMod(d)
+		if err != nil {
+			return nil, err
+		}
+		if module != "" {
+			modules = append(modules, goModule{Dir: d, Path: module})
+		}
+	}
+	// the longest path first, so nested modules win over their parents
+	sort.Slice(modules, func(i, j int) bool { return len(modules[i].Path) > len(modules[j].Path) })
+	return modules, nil
+}
+
+// resolveSrc turns a -src naming a package by import path, such as
+// example.com/mod/pkg or example.com/mod/..., into the directory, or tree,
+// of the workspace module providing it. Paths on disk are returned as is.
+func resolveSrc(src string) (string, error) {
+	if src == "" || filepath.IsAbs(src) || strings.HasPrefix(src, ".") {
+		return src, nil
+	}
+	pkg, tree := strings.CutSuffix(src, "/...")
+	if _, err := os.Stat(pkg); err == nil {
+		return src, nil
+	}
+	modules, err := workspaceModules(".")
+	if err != nil {
+		return "", err
+	}
+	for _, m := range modules {
+		rest, ok := strings.CutPrefix(pkg, m.Path)
+		if !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+			continue
+		}
+		dir := filepath.Join(m.Dir, filepath.FromSlash(rest))
+		if tree {
+			return dir + "/...", nil
+		}
+		return dir, nil
+	}
+	return "", fmt.Errorf("%s: no such file, and no module of the workspace provides the package", src)
+}
+
+// workspaceFilter returns, for a tree walked from root inside a go.work
+// workspace, whether a directory holding a go.mod is a module the workspace
+// does not use, which ./... leaves out as the go command does. Outside a
+// workspace it never skips.
+func workspaceFilter(root string) (func(dir string) bool, error) {
+	work, err := findGoWork(root)
+	if err != nil || work == "" {
+		return func(string) bool { return false }, err
+	}
+	dirs, err := readGoWork(work)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool, len(dirs))
+	for _, d := range dirs {
+		used[d] = true
+	}
+	return func(dir string) bool {
+		abs, err := filepath.Abs(dir)
+		if err != nil || used[abs] {
+			return false
+		}
+		_, err = os.Stat(filepath.Join(abs, "go.mod"))
+		return err == nil
+	}, nil
+}